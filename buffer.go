@@ -0,0 +1,210 @@
+package cloudwatch
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// ErrBufferFull is returned by Write when OverflowBlock is used and the
+// buffer didn't have room before WriterOptions.BlockTimeout. It is also
+// passed to WriterOptions.OnDropped for events dropped by the other overflow
+// policies.
+var ErrBufferFull = errors.New("cloudwatch: buffer is full")
+
+// OverflowPolicy determines what a Writer does when its buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks Write until there is room in the buffer. This is
+	// the default.
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowDropOldest drops the oldest buffered events to make room for
+	// new ones.
+	OverflowDropOldest
+
+	// OverflowDropNewest drops new events until there is room for them.
+	OverflowDropNewest
+
+	// OverflowSample keeps one in every WriterOptions.SampleEvery new
+	// events, dropping the oldest buffered events to make room for it, and
+	// drops the rest.
+	OverflowSample
+)
+
+// defaultSampleEvery is used by OverflowSample when SampleEvery isn't set.
+const defaultSampleEvery = 10
+
+// eventsBuffer represents a buffer of cloudwatch events that are protected by a
+// mutex.
+type eventsBuffer struct {
+	sync.Mutex
+	events []*cloudwatchlogs.InputLogEvent
+	bytes  int
+
+	// The limits of the buffer. Zero means there is no limit.
+	maxEvents, maxBytes int
+
+	overflow     OverflowPolicy
+	sampleEvery  int
+	blockTimeout time.Duration
+
+	// overflowed counts the events that arrived while the buffer was full,
+	// for sampling.
+	overflowed int
+
+	// dropped counts the events dropped since the last call to takeDropped,
+	// and total counts all the events ever dropped.
+	dropped int
+	total   int64
+
+	// space is closed when events are drained, to wake blocked calls to add.
+	space chan struct{}
+
+	// onFull, if set, is called before add blocks waiting for room, so that
+	// a flush makes some.
+	onFull func()
+}
+
+func (b *eventsBuffer) full(size int) bool {
+	return (b.maxEvents > 0 && len(b.events)+1 > b.maxEvents) ||
+		(b.maxBytes > 0 && len(b.events) > 0 && b.bytes+size > b.maxBytes)
+}
+
+// add adds event to the buffer, applying the overflow policy if the buffer
+// is full. It returns any events that were dropped as a result.
+func (b *eventsBuffer) add(event *cloudwatchlogs.InputLogEvent) ([]*cloudwatchlogs.InputLogEvent, error) {
+	size := len(*event.Message) + perEventBytes
+
+	b.Lock()
+	defer b.Unlock()
+
+	if !b.full(size) {
+		b.push(event)
+		return nil, nil
+	}
+
+	switch b.overflow {
+	case OverflowDropNewest:
+		b.drop()
+		return []*cloudwatchlogs.InputLogEvent{event}, nil
+	case OverflowSample:
+		every := b.sampleEvery
+		if every <= 0 {
+			every = defaultSampleEvery
+		}
+		b.overflowed++
+		if b.overflowed%every != 0 {
+			b.drop()
+			return []*cloudwatchlogs.InputLogEvent{event}, nil
+		}
+		fallthrough
+	case OverflowDropOldest:
+		var dropped []*cloudwatchlogs.InputLogEvent
+		for len(b.events) > 0 && b.full(size) {
+			dropped = append(dropped, b.events[0])
+			b.bytes -= len(*b.events[0].Message) + perEventBytes
+			b.events = b.events[1:]
+			b.drop()
+		}
+		b.push(event)
+		return dropped, nil
+	}
+
+	// OverflowBlock
+	var timeout <-chan time.Time
+	if b.blockTimeout > 0 {
+		t := time.NewTimer(b.blockTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	for b.full(size) {
+		if b.space == nil {
+			b.space = make(chan struct{})
+		}
+		space := b.space
+
+		b.Unlock()
+		if b.onFull != nil {
+			b.onFull()
+		}
+		select {
+		case <-space:
+		case <-timeout:
+			b.Lock()
+			return nil, ErrBufferFull
+		}
+		b.Lock()
+	}
+
+	b.push(event)
+	return nil, nil
+}
+
+// push adds event to the buffer regardless of its limits. The buffer must be
+// locked.
+func (b *eventsBuffer) push(event *cloudwatchlogs.InputLogEvent) {
+	b.events = append(b.events, event)
+	b.bytes += len(*event.Message) + perEventBytes
+}
+
+// prepend adds events to the front of the buffer.
+func (b *eventsBuffer) prepend(events []*cloudwatchlogs.InputLogEvent) {
+	b.Lock()
+	defer b.Unlock()
+
+	for _, event := range events {
+		b.bytes += len(*event.Message) + perEventBytes
+	}
+	b.events = append(events[:len(events):len(events)], b.events...)
+}
+
+func (b *eventsBuffer) drain() []*cloudwatchlogs.InputLogEvent {
+	b.Lock()
+	defer b.Unlock()
+
+	events := b.events[:]
+	b.events = nil
+	b.bytes = 0
+
+	if b.space != nil {
+		close(b.space)
+		b.space = nil
+	}
+	return events
+}
+
+func (b *eventsBuffer) drop() {
+	b.dropped++
+	b.total++
+}
+
+// size returns the number of events in the buffer, and their size in bytes.
+func (b *eventsBuffer) size() (events, bytes int) {
+	b.Lock()
+	defer b.Unlock()
+
+	return len(b.events), b.bytes
+}
+
+// takeDropped returns the number of events dropped since it was last called.
+func (b *eventsBuffer) takeDropped() int {
+	b.Lock()
+	defer b.Unlock()
+
+	dropped := b.dropped
+	b.dropped = 0
+	return dropped
+}
+
+// droppedTotal returns the number of events ever dropped.
+func (b *eventsBuffer) droppedTotal() int64 {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.total
+}
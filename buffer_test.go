@@ -0,0 +1,154 @@
+package cloudwatch
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/eltorocorp/cloudwatch/cloudwatchtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func messages(events []*cloudwatchlogs.InputLogEvent) []string {
+	var m []string
+	for _, event := range events {
+		m = append(m, *event.Message)
+	}
+	return m
+}
+
+func TestEventsBuffer_Overflow(t *testing.T) {
+	add := func(b *eventsBuffer, messages ...string) {
+		for _, message := range messages {
+			_, err := b.add(&cloudwatchlogs.InputLogEvent{
+				Message:   aws.String(message),
+				Timestamp: aws.Int64(1000),
+			})
+			assert.NoError(t, err)
+		}
+	}
+
+	t.Run("drop oldest", func(t *testing.T) {
+		b := &eventsBuffer{maxEvents: 2, overflow: OverflowDropOldest}
+		add(b, "a", "b", "c")
+		assert.Equal(t, []string{"b", "c"}, messages(b.drain()))
+		assert.Equal(t, 1, b.takeDropped())
+	})
+
+	t.Run("drop newest", func(t *testing.T) {
+		b := &eventsBuffer{maxBytes: 2 * (1 + perEventBytes), overflow: OverflowDropNewest}
+		add(b, "a", "b", "c")
+		assert.Equal(t, []string{"a", "b"}, messages(b.drain()))
+		assert.Equal(t, 1, b.takeDropped())
+		assert.Equal(t, 0, b.takeDropped())
+	})
+
+	t.Run("sample", func(t *testing.T) {
+		b := &eventsBuffer{maxEvents: 1, overflow: OverflowSample, sampleEvery: 2}
+		add(b, "a", "b", "c", "d")
+		assert.Equal(t, []string{"c"}, messages(b.drain()))
+		assert.Equal(t, int64(3), b.droppedTotal())
+	})
+}
+
+func TestEventsBuffer_Block(t *testing.T) {
+	b := &eventsBuffer{maxEvents: 1, blockTimeout: 10 * time.Millisecond}
+
+	_, err := b.add(&cloudwatchlogs.InputLogEvent{Message: aws.String("a"), Timestamp: aws.Int64(1000)})
+	assert.NoError(t, err)
+
+	_, err = b.add(&cloudwatchlogs.InputLogEvent{Message: aws.String("b"), Timestamp: aws.Int64(1000)})
+	assert.Equal(t, ErrBufferFull, err)
+
+	b.blockTimeout = 0
+	added := make(chan error)
+	go func() {
+		_, err := b.add(&cloudwatchlogs.InputLogEvent{Message: aws.String("c"), Timestamp: aws.Int64(1000)})
+		added <- err
+	}()
+
+	select {
+	case <-added:
+		t.Fatal("expected add to block")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	assert.Equal(t, []string{"a"}, messages(b.drain()))
+	assert.NoError(t, <-added)
+	assert.Equal(t, []string{"c"}, messages(b.drain()))
+}
+
+func TestWriter_BlockFlushes(t *testing.T) {
+	f := cloudwatchtest.New()
+	f.Now = now
+
+	g, err := AttachGroup("group", f)
+	assert.NoError(t, err)
+
+	// The first line doesn't reach MaxBufferedBytes, but the second doesn't
+	// fit alongside it. Waiting for room starts a flush, rather than waiting
+	// for the next tick.
+	line := strings.Repeat("a", 59) + "\n"
+	w, err := g.AttachStreamWithOptions("1234", WriterOptions{
+		FlushEvery:       time.Hour,
+		MaxBufferedBytes: 100,
+		BlockTimeout:     time.Second,
+	})
+	assert.NoError(t, err)
+	defer w.Close()
+
+	_, err = io.WriteString(w, line)
+	assert.NoError(t, err)
+	_, err = io.WriteString(w, line)
+	assert.NoError(t, err)
+
+	assert.NoError(t, w.Close())
+	assert.Equal(t, []string{line, line}, f.Messages("group", "1234"))
+}
+
+func TestWriter_DroppedEvents(t *testing.T) {
+	var dropped []*cloudwatchlogs.InputLogEvent
+
+	c := new(mockClient)
+	w := &Writer{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: c,
+		core:   newStreamCore(),
+		opts: WriterOptions{
+			OnDropped: func(events []*cloudwatchlogs.InputLogEvent, err error) {
+				assert.Equal(t, ErrBufferFull, err)
+				dropped = append(dropped, events...)
+			},
+		},
+		events: eventsBuffer{maxEvents: 1, overflow: OverflowDropNewest},
+	}
+
+	c.On("PutLogEvents", &cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("Hello\n"), Timestamp: aws.Int64(1000)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	}).Once().Return(&cloudwatchlogs.PutLogEventsOutput{}, nil)
+
+	c.On("PutLogEvents", &cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("1 events dropped"), Timestamp: aws.Int64(1000)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	}).Once().Return(&cloudwatchlogs.PutLogEventsOutput{}, nil)
+
+	io.WriteString(w, "Hello\nWorld\n")
+	assert.Equal(t, []string{"World\n"}, messages(dropped))
+	assert.Equal(t, int64(1), w.Dropped())
+
+	assert.NoError(t, w.Flush())
+	assert.NoError(t, w.Flush())
+
+	c.AssertExpectations(t)
+}
@@ -0,0 +1,192 @@
+package cloudwatch
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CloudWatch Logs tokens expire after 24 hours, after which a Reader resumes
+// from the timestamp of a checkpoint instead.
+const tokenExpiry = 24 * time.Hour
+
+// Checkpoint records how far a Reader has got through a stream.
+type Checkpoint struct {
+	// Token is the forward token for the events after the last one read.
+	Token string `json:"token,omitempty"`
+
+	// Timestamp is the timestamp of the last event read.
+	Timestamp time.Time `json:"timestamp"`
+
+	// Saved is when the checkpoint was saved, which is used to tell whether
+	// Token has expired.
+	Saved time.Time `json:"saved"`
+}
+
+// Checkpointer stores checkpoints for streams, so that a Reader can resume
+// where a previous one left off. See ReaderOptions.Checkpointer.
+type Checkpointer interface {
+	// Load returns the checkpoint saved for a stream, or nil if there
+	// isn't one.
+	Load(group, stream string) (*Checkpoint, error)
+
+	// Save saves the checkpoint for a stream, replacing any previous one.
+	Save(group, stream string, checkpoint Checkpoint) error
+}
+
+// checkpointKey identifies a stream. Log group and stream names can't contain
+// colons.
+func checkpointKey(group, stream string) string {
+	return group + ":" + stream
+}
+
+// MemoryCheckpointer is a Checkpointer that keeps checkpoints in memory, for
+// Readers that are replaced during the life of a process.
+type MemoryCheckpointer struct {
+	sync.Mutex
+	checkpoints map[string]Checkpoint
+}
+
+// NewMemoryCheckpointer returns an empty MemoryCheckpointer.
+func NewMemoryCheckpointer() *MemoryCheckpointer {
+	return &MemoryCheckpointer{checkpoints: make(map[string]Checkpoint)}
+}
+
+func (c *MemoryCheckpointer) Load(group, stream string) (*Checkpoint, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	checkpoint, ok := c.checkpoints[checkpointKey(group, stream)]
+	if !ok {
+		return nil, nil
+	}
+	return &checkpoint, nil
+}
+
+func (c *MemoryCheckpointer) Save(group, stream string, checkpoint Checkpoint) error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.checkpoints[checkpointKey(group, stream)] = checkpoint
+	return nil
+}
+
+// FileCheckpointer is a Checkpointer that keeps the checkpoints for every
+// stream in a JSON file. The file is replaced atomically on each save, so a
+// crash leaves the previous checkpoints in place.
+type FileCheckpointer struct {
+	path string
+
+	sync.Mutex
+	checkpoints map[string]Checkpoint
+}
+
+// NewFileCheckpointer returns a FileCheckpointer that stores checkpoints in
+// the file at path, loading any that are already there. A path should only
+// be used by one process at a time.
+func NewFileCheckpointer(path string) (*FileCheckpointer, error) {
+	c := &FileCheckpointer{
+		path:        path,
+		checkpoints: make(map[string]Checkpoint),
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &c.checkpoints); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *FileCheckpointer) Load(group, stream string) (*Checkpoint, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	checkpoint, ok := c.checkpoints[checkpointKey(group, stream)]
+	if !ok {
+		return nil, nil
+	}
+	return &checkpoint, nil
+}
+
+func (c *FileCheckpointer) Save(group, stream string, checkpoint Checkpoint) error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.checkpoints[checkpointKey(group, stream)] = checkpoint
+
+	b, err := json.Marshal(c.checkpoints)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// KVStore is a key-value store, such as Redis, etcd or DynamoDB, that
+// checkpoints can be kept in with NewKVCheckpointer.
+type KVStore interface {
+	// Get returns the value for key, or nil if there isn't one.
+	Get(key string) ([]byte, error)
+
+	// Put sets the value for key.
+	Put(key string, value []byte) error
+}
+
+// kvCheckpointer is a Checkpointer that keeps checkpoints in a KVStore.
+type kvCheckpointer struct {
+	store  KVStore
+	prefix string
+}
+
+// NewKVCheckpointer returns a Checkpointer that keeps checkpoints in store,
+// encoded as JSON, under keys that start with prefix.
+func NewKVCheckpointer(store KVStore, prefix string) Checkpointer {
+	return &kvCheckpointer{store: store, prefix: prefix}
+}
+
+func (c *kvCheckpointer) Load(group, stream string) (*Checkpoint, error) {
+	b, err := c.store.Get(c.prefix + checkpointKey(group, stream))
+	if err != nil || b == nil {
+		return nil, err
+	}
+
+	checkpoint := &Checkpoint{}
+	if err := json.Unmarshal(b, checkpoint); err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+func (c *kvCheckpointer) Save(group, stream string, checkpoint Checkpoint) error {
+	b, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	return c.store.Put(c.prefix+checkpointKey(group, stream), b)
+}
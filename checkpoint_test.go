@@ -0,0 +1,69 @@
+package cloudwatch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryKVStore is a KVStore backed by a map.
+type memoryKVStore map[string][]byte
+
+func (s memoryKVStore) Get(key string) ([]byte, error) { return s[key], nil }
+
+func (s memoryKVStore) Put(key string, value []byte) error {
+	s[key] = value
+	return nil
+}
+
+func testCheckpointer(t *testing.T, c Checkpointer) {
+	checkpoint, err := c.Load("group", "1234")
+	assert.NoError(t, err)
+	assert.Nil(t, checkpoint)
+
+	saved := Checkpoint{
+		Token:     "next",
+		Timestamp: time.Unix(2, 0).UTC(),
+		Saved:     time.Unix(3, 0).UTC(),
+	}
+	assert.NoError(t, c.Save("group", "1234", saved))
+	assert.NoError(t, c.Save("group", "5678", Checkpoint{Token: "other"}))
+
+	checkpoint, err = c.Load("group", "1234")
+	assert.NoError(t, err)
+	assert.Equal(t, &saved, checkpoint)
+}
+
+func TestMemoryCheckpointer(t *testing.T) {
+	testCheckpointer(t, NewMemoryCheckpointer())
+}
+
+func TestFileCheckpointer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoints.json")
+
+	c, err := NewFileCheckpointer(path)
+	assert.NoError(t, err)
+	testCheckpointer(t, c)
+
+	// The checkpoints are loaded from the file.
+	c, err = NewFileCheckpointer(path)
+	assert.NoError(t, err)
+	checkpoint, err := c.Load("group", "5678")
+	assert.NoError(t, err)
+	assert.Equal(t, "other", checkpoint.Token)
+}
+
+func TestKVCheckpointer(t *testing.T) {
+	store := memoryKVStore{}
+	testCheckpointer(t, NewKVCheckpointer(store, "checkpoints/"))
+	assert.Contains(t, store, "checkpoints/group:1234")
+}
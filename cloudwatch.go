@@ -1,6 +1,8 @@
 package cloudwatch
 
 import (
+	"context"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -14,6 +16,7 @@ const (
 	readThrottle = time.Second / 10
 
 	// The maximum rate of a PutLogEvents request is 5 requests per second per log stream.
+	putThrottle       = time.Second / 5
 	defaultFlushEvery = 5 * time.Second
 )
 
@@ -25,14 +28,63 @@ var now = time.Now
 // readers and writers for streams.
 type Group struct {
 	group  string
-	client *cloudwatchlogs.CloudWatchLogs
+	client Client
+
+	// streams holds the state shared by the open Writers of each stream.
+	lock    sync.Mutex
+	streams map[string]*streamCore
 }
 
-// AttachGroup creates a reference to a log group.
-func NewGroup(group string, client *cloudwatchlogs.CloudWatchLogs) (*Group, error) {
+// streamCore is the state that the Writers of a stream share, so that they
+// use a single sequence token and stay within the stream's rate limit
+// together.
+type streamCore struct {
+	// sem is held while the other fields are used, including for the
+	// duration of each PutLogEvents request. It's a channel, rather than a
+	// mutex, so that waiting for it can be abandoned when a ctx is done.
+	sem chan struct{}
+
+	sequenceToken *string
+
+	// lastPut is when the last PutLogEvents request was, or is reserved to
+	// be, made, used to stay within the per stream rate limit.
+	lastPut time.Time
+
+	refs int // Guarded by the Group's lock.
+}
+
+func newStreamCore() *streamCore {
+	return &streamCore{sem: make(chan struct{}, 1)}
+}
+
+// lock takes hold of the stream, or returns ctx.Err() if ctx is done while
+// waiting for it.
+func (c *streamCore) lock(ctx context.Context) error {
+	select {
+	case c.sem <- struct{}{}:
+		return nil
+	default:
+	}
+
+	select {
+	case c.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *streamCore) unlock() {
+	<-c.sem
+}
+
+// NewGroup creates a reference to a log group, without checking that it
+// exists.
+func NewGroup(group string, client Client) (*Group, error) {
 	return &Group{
-		group:  group,
-		client: client,
+		group:   group,
+		client:  client,
+		streams: make(map[string]*streamCore),
 	}, nil
 }
 
@@ -40,9 +92,9 @@ func NewGroup(group string, client *cloudwatchlogs.CloudWatchLogs) (*Group, erro
 //
 // If the group already exists, it is used.
 // If the group doesn't exist, it is created.
-func AttachGroup(group string, client *cloudwatchlogs.CloudWatchLogs) (*Group, error) {
+func AttachGroup(group string, client Client) (*Group, error) {
 	// attempt to find first
-	describeGroupOutput, err := client.DescribeLogGroups(&cloudwatchlogs.DescribeLogGroupsInput{
+	describeGroupOutput, err := client.DescribeLogGroupsWithContext(aws.BackgroundContext(), &cloudwatchlogs.DescribeLogGroupsInput{
 		LogGroupNamePrefix: aws.String(group),
 	})
 	if err != nil {
@@ -58,7 +110,7 @@ func AttachGroup(group string, client *cloudwatchlogs.CloudWatchLogs) (*Group, e
 	createLogGroupInput := &cloudwatchlogs.CreateLogGroupInput{
 		LogGroupName: aws.String(group),
 	}
-	_, err = client.CreateLogGroup(createLogGroupInput)
+	_, err = client.CreateLogGroupWithContext(aws.BackgroundContext(), createLogGroupInput)
 	if err != nil {
 		if awsErr, ok := err.(awserr.Error); ok {
 			if awsErr.Code() == cloudwatchlogs.ErrCodeResourceAlreadyExistsException {
@@ -76,12 +128,17 @@ func AttachGroup(group string, client *cloudwatchlogs.CloudWatchLogs) (*Group, e
 //
 // If the requested stream doesn't exist, it is created.
 // If the requested stream already exists, the requested stream is used.
+//
+// Writers attached to the same stream through the same Group share its
+// sequence token and rate limit, so they can be used at the same time.
 func (g *Group) AttachStream(stream string) (*Writer, error) {
 	return g.AttachStreamWithOptions(stream, WriterOptions{FlushEvery: defaultFlushEvery})
 }
 
+// AttachStreamWithOptions is like AttachStream, but configures the Writer
+// with opts.
 func (g *Group) AttachStreamWithOptions(stream string, opts WriterOptions) (*Writer, error) {
-	_, err := g.client.CreateLogStream(&cloudwatchlogs.CreateLogStreamInput{
+	_, err := g.client.CreateLogStreamWithContext(aws.BackgroundContext(), &cloudwatchlogs.CreateLogStreamInput{
 		LogGroupName:  &g.group,
 		LogStreamName: &stream,
 	})
@@ -96,10 +153,66 @@ func (g *Group) AttachStreamWithOptions(stream string, opts WriterOptions) (*Wri
 		}
 	}
 
-	return NewWriter(g.group, stream, g.client, opts), nil
+	core := g.acquire(stream)
+	w, err := newWriter(g.group, stream, g.client, opts, core)
+	if err != nil {
+		g.release(stream, core)
+		return nil, err
+	}
+	w.release = func() { g.release(stream, core) }
+	return w, nil
+}
+
+// acquire returns the state shared by the Writers of stream, adding a
+// reference to it.
+func (g *Group) acquire(stream string) *streamCore {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.streams == nil {
+		g.streams = make(map[string]*streamCore)
+	}
+	core, ok := g.streams[stream]
+	if !ok {
+		core = newStreamCore()
+		g.streams[stream] = core
+	}
+	core.refs++
+	return core
+}
+
+// release drops a reference to the state shared by the Writers of stream,
+// forgetting it once no Writers are left.
+func (g *Group) release(stream string, core *streamCore) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	core.refs--
+	if core.refs == 0 && g.streams[stream] == core {
+		delete(g.streams, stream)
+	}
 }
 
 // Open returns an Reader to read from the log stream.
 func (g *Group) Open(stream string) (*Reader, error) {
 	return NewReader(g.group, stream, g.client), nil
 }
+
+// OpenWithOptions is like Open, but configures the Reader with opts.
+func (g *Group) OpenWithOptions(stream string, opts ReaderOptions) (*Reader, error) {
+	return NewReaderWithOptions(g.group, stream, g.client, opts), nil
+}
+
+// OpenAll returns a Reader that reads the events from every stream in the
+// group, or the streams selected by opts, in chronological order. Events
+// returned by the Reader's Next method have their Stream and ID set.
+func (g *Group) OpenAll(opts GroupReaderOptions) (*Reader, error) {
+	return newGroupReader(g.group, g.client, opts)
+}
+
+// Follow returns a Reader that follows the streams in the group, or the
+// streams selected by opts, including those that are created after it starts.
+// Events returned by the Reader's Next method have their Stream set.
+func (g *Group) Follow(opts FollowOptions) (*Reader, error) {
+	return newFollower(g.group, g.client, opts)
+}
@@ -1,8 +1,16 @@
 package cloudwatch
 
 import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -16,12 +24,157 @@ func (c *mockClient) PutLogEvents(input *cloudwatchlogs.PutLogEventsInput) (*clo
 	return args.Get(0).(*cloudwatchlogs.PutLogEventsOutput), args.Error(1)
 }
 
+func (c *mockClient) PutLogEventsWithContext(ctx aws.Context, input *cloudwatchlogs.PutLogEventsInput, opts ...request.Option) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	return c.PutLogEvents(input)
+}
+
 func (c *mockClient) CreateLogStream(input *cloudwatchlogs.CreateLogStreamInput) (*cloudwatchlogs.CreateLogStreamOutput, error) {
 	args := c.Called(input)
 	return args.Get(0).(*cloudwatchlogs.CreateLogStreamOutput), args.Error(1)
 }
 
+func (c *mockClient) CreateLogStreamWithContext(ctx aws.Context, input *cloudwatchlogs.CreateLogStreamInput, opts ...request.Option) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+	return c.CreateLogStream(input)
+}
+
+func (c *mockClient) CreateLogGroup(input *cloudwatchlogs.CreateLogGroupInput) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+	args := c.Called(input)
+	return args.Get(0).(*cloudwatchlogs.CreateLogGroupOutput), args.Error(1)
+}
+
+func (c *mockClient) CreateLogGroupWithContext(ctx aws.Context, input *cloudwatchlogs.CreateLogGroupInput, opts ...request.Option) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+	return c.CreateLogGroup(input)
+}
+
+func (c *mockClient) DescribeLogGroups(input *cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+	args := c.Called(input)
+	return args.Get(0).(*cloudwatchlogs.DescribeLogGroupsOutput), args.Error(1)
+}
+
+func (c *mockClient) DescribeLogGroupsWithContext(ctx aws.Context, input *cloudwatchlogs.DescribeLogGroupsInput, opts ...request.Option) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+	return c.DescribeLogGroups(input)
+}
+
 func (c *mockClient) GetLogEvents(input *cloudwatchlogs.GetLogEventsInput) (*cloudwatchlogs.GetLogEventsOutput, error) {
 	args := c.Called(input)
 	return args.Get(0).(*cloudwatchlogs.GetLogEventsOutput), args.Error(1)
 }
+
+func (c *mockClient) GetLogEventsWithContext(ctx aws.Context, input *cloudwatchlogs.GetLogEventsInput, opts ...request.Option) (*cloudwatchlogs.GetLogEventsOutput, error) {
+	return c.GetLogEvents(input)
+}
+
+func (c *mockClient) FilterLogEvents(input *cloudwatchlogs.FilterLogEventsInput) (*cloudwatchlogs.FilterLogEventsOutput, error) {
+	args := c.Called(input)
+	return args.Get(0).(*cloudwatchlogs.FilterLogEventsOutput), args.Error(1)
+}
+
+func (c *mockClient) FilterLogEventsWithContext(ctx aws.Context, input *cloudwatchlogs.FilterLogEventsInput, opts ...request.Option) (*cloudwatchlogs.FilterLogEventsOutput, error) {
+	return c.FilterLogEvents(input)
+}
+
+func TestAttachGroup_Existing(t *testing.T) {
+	c := new(mockClient)
+
+	c.On("DescribeLogGroups", &cloudwatchlogs.DescribeLogGroupsInput{
+		LogGroupNamePrefix: aws.String("group"),
+	}).Return(&cloudwatchlogs.DescribeLogGroupsOutput{
+		LogGroups: []*cloudwatchlogs.LogGroup{
+			{LogGroupName: aws.String("group-other")},
+			{LogGroupName: aws.String("group")},
+		},
+	}, nil)
+
+	g, err := AttachGroup("group", c)
+	assert.NoError(t, err)
+	assert.Equal(t, "group", g.group)
+
+	c.AssertExpectations(t)
+}
+
+func TestAttachGroup_Create(t *testing.T) {
+	for _, createErr := range []error{
+		nil,
+		awserr.New(cloudwatchlogs.ErrCodeResourceAlreadyExistsException, "exists", nil),
+	} {
+		c := new(mockClient)
+
+		c.On("DescribeLogGroups", &cloudwatchlogs.DescribeLogGroupsInput{
+			LogGroupNamePrefix: aws.String("group"),
+		}).Return(&cloudwatchlogs.DescribeLogGroupsOutput{
+			LogGroups: []*cloudwatchlogs.LogGroup{
+				{LogGroupName: aws.String("group-other")},
+			},
+		}, nil)
+
+		c.On("CreateLogGroup", &cloudwatchlogs.CreateLogGroupInput{
+			LogGroupName: aws.String("group"),
+		}).Return(&cloudwatchlogs.CreateLogGroupOutput{}, createErr)
+
+		g, err := AttachGroup("group", c)
+		assert.NoError(t, err)
+		assert.Equal(t, "group", g.group)
+
+		c.AssertExpectations(t)
+	}
+}
+
+func TestAttachGroup_Err(t *testing.T) {
+	c := new(mockClient)
+
+	errBoom := errors.New("boom")
+	c.On("DescribeLogGroups", &cloudwatchlogs.DescribeLogGroupsInput{
+		LogGroupNamePrefix: aws.String("group"),
+	}).Return(&cloudwatchlogs.DescribeLogGroupsOutput{}, nil)
+
+	c.On("CreateLogGroup", &cloudwatchlogs.CreateLogGroupInput{
+		LogGroupName: aws.String("group"),
+	}).Return(&cloudwatchlogs.CreateLogGroupOutput{}, errBoom)
+
+	_, err := AttachGroup("group", c)
+	assert.Equal(t, errBoom, err)
+
+	c.AssertExpectations(t)
+}
+
+func TestGroup_AttachStreamWithOptions(t *testing.T) {
+	for _, createErr := range []error{
+		nil,
+		awserr.New(cloudwatchlogs.ErrCodeResourceAlreadyExistsException, "exists", nil),
+	} {
+		c := new(mockClient)
+		g, err := NewGroup("group", c)
+		assert.NoError(t, err)
+
+		c.On("CreateLogStream", &cloudwatchlogs.CreateLogStreamInput{
+			LogGroupName:  aws.String("group"),
+			LogStreamName: aws.String("1234"),
+		}).Return(&cloudwatchlogs.CreateLogStreamOutput{}, createErr)
+
+		w, err := g.AttachStreamWithOptions("1234", WriterOptions{FlushEvery: time.Hour})
+		assert.NoError(t, err)
+		assert.Equal(t, "group", *w.group)
+		assert.Equal(t, "1234", *w.stream)
+		assert.Equal(t, time.Hour, w.opts.FlushEvery)
+		assert.NoError(t, w.Close())
+
+		c.AssertExpectations(t)
+	}
+}
+
+func TestGroup_AttachStreamWithOptions_Err(t *testing.T) {
+	c := new(mockClient)
+	g, err := NewGroup("group", c)
+	assert.NoError(t, err)
+
+	errDenied := awserr.New("AccessDeniedException", "denied", nil)
+	c.On("CreateLogStream", &cloudwatchlogs.CreateLogStreamInput{
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	}).Return(&cloudwatchlogs.CreateLogStreamOutput{}, errDenied)
+
+	_, err = g.AttachStreamWithOptions("1234", WriterOptions{})
+	assert.Equal(t, errDenied, err)
+
+	c.AssertExpectations(t)
+}
@@ -0,0 +1,408 @@
+package cloudwatchtest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/eltorocorp/cloudwatch/filterpattern"
+)
+
+// Limits from http://docs.aws.amazon.com/AmazonCloudWatch/latest/DeveloperGuide/cloudwatch_limits.html
+const (
+	perEventBytes          = 26
+	maximumBytesPerPut     = 1048576
+	maximumLogEventsPerPut = 10000
+	maximumBytesPerEvent   = 262144 - perEventBytes
+
+	// The events in a PutLogEvents request can't span more than 24 hours.
+	maximumBatchSpan = int64(24 * time.Hour / time.Millisecond)
+
+	// Events older than 14 days or more than 2 hours in the future are
+	// rejected.
+	maximumEventAge    = int64(14 * 24 * time.Hour / time.Millisecond)
+	maximumEventFuture = int64(2 * time.Hour / time.Millisecond)
+
+	// The default and maximum number of events returned by GetLogEvents and
+	// FilterLogEvents.
+	defaultEventsLimit = 10000
+)
+
+func (f *Fake) PutLogEvents(input *cloudwatchlogs.PutLogEventsInput) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	return f.PutLogEventsWithContext(aws.BackgroundContext(), input)
+}
+
+// PutLogEventsWithContext stores events, checking the request against the
+// same limits as CloudWatch Logs. Events that are too old or too new are
+// reported in RejectedLogEventsInfo and not stored.
+func (f *Fake) PutLogEventsWithContext(ctx aws.Context, input *cloudwatchlogs.PutLogEventsInput, _ ...request.Option) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call(ctx, "PutLogEvents"); err != nil {
+		return nil, err
+	}
+
+	if input.LogStreamName == nil {
+		return nil, invalidParameter("logStreamName is required")
+	}
+	_, s, err := f.lookup(input.LogGroupName, input.LogStreamName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateBatch(input.LogEvents); err != nil {
+		return nil, err
+	}
+
+	batch := batchKey(input.LogEvents)
+	if s.lastBatch != "" && batch == s.lastBatch && aws.StringValue(input.SequenceToken) == aws.StringValue(s.lastToken) {
+		return nil, awserr.New(cloudwatchlogs.ErrCodeDataAlreadyAcceptedException,
+			"The given batch of log events has already been accepted. The next batch can be sent with sequenceToken: "+tokenString(s.token), nil)
+	}
+	if aws.StringValue(input.SequenceToken) != aws.StringValue(s.token) {
+		return nil, awserr.New(cloudwatchlogs.ErrCodeInvalidSequenceTokenException,
+			"The given sequenceToken is invalid. The next expected sequenceToken is: "+tokenString(s.token), nil)
+	}
+
+	now := f.now()
+	out := &cloudwatchlogs.PutLogEventsOutput{}
+
+	// The events are in chronological order, so the ones that are too old
+	// are at the start and the ones that are too new are at the end.
+	tooOld, tooNew := 0, len(input.LogEvents)
+	for i, e := range input.LogEvents {
+		if *e.Timestamp < now-maximumEventAge {
+			tooOld = i + 1
+		}
+		if *e.Timestamp > now+maximumEventFuture && i < tooNew {
+			tooNew = i
+		}
+	}
+	if tooOld > 0 || tooNew < len(input.LogEvents) {
+		out.RejectedLogEventsInfo = &cloudwatchlogs.RejectedLogEventsInfo{}
+		if tooOld > 0 {
+			out.RejectedLogEventsInfo.TooOldLogEventEndIndex = aws.Int64(int64(tooOld))
+		}
+		if tooNew < len(input.LogEvents) {
+			out.RejectedLogEventsInfo.TooNewLogEventStartIndex = aws.Int64(int64(tooNew))
+		}
+	}
+
+	for _, e := range input.LogEvents[tooOld:tooNew] {
+		s.events = append(s.events, &event{
+			id:        f.nextID(),
+			timestamp: *e.Timestamp,
+			ingestion: now,
+			message:   *e.Message,
+		})
+	}
+
+	s.lastToken = input.SequenceToken
+	s.lastBatch = batch
+	s.token = f.nextToken()
+	out.NextSequenceToken = s.token
+	return out, nil
+}
+
+// validateBatch checks the limits that cause CloudWatch Logs to reject a
+// whole PutLogEvents request.
+func validateBatch(events []*cloudwatchlogs.InputLogEvent) error {
+	if len(events) == 0 {
+		return invalidParameter("logEvents must contain at least 1 event")
+	}
+	if len(events) > maximumLogEventsPerPut {
+		return invalidParameter("logEvents must contain at most %d events", maximumLogEventsPerPut)
+	}
+
+	size := 0
+	for i, e := range events {
+		if e.Message == nil || e.Timestamp == nil {
+			return invalidParameter("logEvents[%d] must have a message and a timestamp", i)
+		}
+		if len(*e.Message) == 0 {
+			return invalidParameter("logEvents[%d].message must not be empty", i)
+		}
+		if len(*e.Message) > maximumBytesPerEvent {
+			return invalidParameter("Log event too large: %d bytes exceeds limit of %d", len(*e.Message)+perEventBytes, maximumBytesPerEvent+perEventBytes)
+		}
+		size += len(*e.Message) + perEventBytes
+
+		if i > 0 && *e.Timestamp < *events[i-1].Timestamp {
+			return invalidParameter("Log events in a single PutLogEvents request must be in chronological order.")
+		}
+	}
+
+	if size > maximumBytesPerPut {
+		return invalidParameter("Upload too large: %d bytes exceeds limit of %d", size, maximumBytesPerPut)
+	}
+	if *events[len(events)-1].Timestamp-*events[0].Timestamp > maximumBatchSpan {
+		return invalidParameter("The batch of log events in a single PutLogEvents request cannot span more than 24 hours.")
+	}
+	return nil
+}
+
+// batchKey identifies the contents of a batch, to detect it being sent twice.
+func batchKey(events []*cloudwatchlogs.InputLogEvent) string {
+	var b strings.Builder
+	for _, e := range events {
+		fmt.Fprintf(&b, "%d:%d:%s\n", *e.Timestamp, len(*e.Message), *e.Message)
+	}
+	return b.String()
+}
+
+func tokenString(token *string) string {
+	if token == nil {
+		return "null"
+	}
+	return *token
+}
+
+func (f *Fake) GetLogEvents(input *cloudwatchlogs.GetLogEventsInput) (*cloudwatchlogs.GetLogEventsOutput, error) {
+	return f.GetLogEventsWithContext(aws.BackgroundContext(), input)
+}
+
+// GetLogEventsWithContext returns events from a stream in the order they were
+// put.
+//
+// Like CloudWatch Logs, a forward token that has reached the end of the
+// stream is returned unchanged, so it can be used again to poll for new
+// events. Without a token, StartFromHead chooses between the first and the
+// last events in the time range. As with CloudWatch Logs, StartFromHead must
+// be true when NextToken is a forward token.
+func (f *Fake) GetLogEventsWithContext(ctx aws.Context, input *cloudwatchlogs.GetLogEventsInput, _ ...request.Option) (*cloudwatchlogs.GetLogEventsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call(ctx, "GetLogEvents"); err != nil {
+		return nil, err
+	}
+
+	if input.LogStreamName == nil {
+		return nil, invalidParameter("logStreamName is required")
+	}
+	_, s, err := f.lookup(input.LogGroupName, input.LogStreamName)
+	if err != nil {
+		return nil, err
+	}
+
+	limit, err := eventsLimit(input.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	inRange := func(e *event) bool {
+		return (input.StartTime == nil || e.timestamp >= *input.StartTime) &&
+			(input.EndTime == nil || e.timestamp < *input.EndTime)
+	}
+
+	forward := aws.BoolValue(input.StartFromHead)
+	position := 0
+	if !forward {
+		position = len(s.events)
+	}
+	if input.NextToken != nil {
+		forward, position, err = parseStreamToken(*input.NextToken, len(s.events))
+		if err != nil {
+			return nil, err
+		}
+		if forward && !aws.BoolValue(input.StartFromHead) {
+			return nil, invalidParameter("startFromHead must be true when nextToken is a nextForwardToken.")
+		}
+	}
+
+	// Scan from position in the chosen direction, so that [start, end) is
+	// the range of events that has been looked at.
+	var matched []*event
+	start, end := position, position
+	if forward {
+		for ; end < len(s.events) && len(matched) < limit; end++ {
+			if inRange(s.events[end]) {
+				matched = append(matched, s.events[end])
+			}
+		}
+	} else {
+		for ; start > 0 && len(matched) < limit; start-- {
+			if inRange(s.events[start-1]) {
+				matched = append([]*event{s.events[start-1]}, matched...)
+			}
+		}
+	}
+
+	out := &cloudwatchlogs.GetLogEventsOutput{
+		Events:            []*cloudwatchlogs.OutputLogEvent{},
+		NextForwardToken:  aws.String(fmt.Sprintf("f/%020d", end)),
+		NextBackwardToken: aws.String(fmt.Sprintf("b/%020d", start)),
+	}
+	for _, e := range matched {
+		out.Events = append(out.Events, e.output())
+	}
+	return out, nil
+}
+
+// parseStreamToken decodes a GetLogEvents token, which is a direction and a
+// position in the stream.
+func parseStreamToken(token string, length int) (forward bool, position int, err error) {
+	invalid := invalidParameter("The specified nextToken is invalid.")
+	if len(token) < 3 || token[1] != '/' || (token[0] != 'f' && token[0] != 'b') {
+		return false, 0, invalid
+	}
+	position, perr := strconv.Atoi(token[2:])
+	if perr != nil || position < 0 || position > length {
+		return false, 0, invalid
+	}
+	return token[0] == 'f', position, nil
+}
+
+func eventsLimit(limit *int64) (int, error) {
+	if limit == nil {
+		return defaultEventsLimit, nil
+	}
+	if *limit < 1 || *limit > defaultEventsLimit {
+		return 0, invalidParameter("limit must be between 1 and %d", defaultEventsLimit)
+	}
+	return int(*limit), nil
+}
+
+func (f *Fake) FilterLogEvents(input *cloudwatchlogs.FilterLogEventsInput) (*cloudwatchlogs.FilterLogEventsOutput, error) {
+	return f.FilterLogEventsWithContext(aws.BackgroundContext(), input)
+}
+
+// FilterLogEventsWithContext returns the events from the streams of a group
+// that match FilterPattern, in timestamp order. Patterns are evaluated with
+// the filterpattern package.
+func (f *Fake) FilterLogEventsWithContext(ctx aws.Context, input *cloudwatchlogs.FilterLogEventsInput, _ ...request.Option) (*cloudwatchlogs.FilterLogEventsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call(ctx, "FilterLogEvents"); err != nil {
+		return nil, err
+	}
+
+	g, _, err := f.lookup(input.LogGroupName, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.LogStreamNames != nil && input.LogStreamNamePrefix != nil {
+		return nil, invalidParameter("Cannot specify both logStreamNames and logStreamNamePrefix")
+	}
+
+	limit, err := eventsLimit(input.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	pattern, err := filterpattern.Compile(aws.StringValue(input.FilterPattern))
+	if err != nil {
+		return nil, invalidParameter("Invalid filter pattern: " + strings.TrimPrefix(err.Error(), "filterpattern: "))
+	}
+
+	var streams []*stream
+	if input.LogStreamNames != nil {
+		for _, name := range input.LogStreamNames {
+			s, ok := g.streams[aws.StringValue(name)]
+			if !ok {
+				return nil, notFound("The specified log stream does not exist.")
+			}
+			streams = append(streams, s)
+		}
+	} else {
+		for _, s := range g.streams {
+			if strings.HasPrefix(s.name, aws.StringValue(input.LogStreamNamePrefix)) {
+				streams = append(streams, s)
+			}
+		}
+	}
+	sort.Slice(streams, func(i, j int) bool { return streams[i].name < streams[j].name })
+
+	type filtered struct {
+		stream string
+		*event
+	}
+
+	var after *event
+	if input.NextToken != nil {
+		after, err = parseFilterToken(*input.NextToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var events []filtered
+	for _, s := range streams {
+		for _, e := range s.events {
+			if input.StartTime != nil && e.timestamp < *input.StartTime {
+				continue
+			}
+			if input.EndTime != nil && e.timestamp > *input.EndTime {
+				continue
+			}
+			if !pattern.Match(e.message) {
+				continue
+			}
+			events = append(events, filtered{s.name, e})
+		}
+	}
+
+	// Event IDs increase in the order events were put, so sorting by
+	// timestamp then ID gives a stable order to page through.
+	less := func(a, b *event) bool {
+		if a.timestamp != b.timestamp {
+			return a.timestamp < b.timestamp
+		}
+		return a.id < b.id
+	}
+	sort.Slice(events, func(i, j int) bool { return less(events[i].event, events[j].event) })
+
+	out := &cloudwatchlogs.FilterLogEventsOutput{
+		Events: []*cloudwatchlogs.FilteredLogEvent{},
+	}
+	for _, s := range streams {
+		out.SearchedLogStreams = append(out.SearchedLogStreams, &cloudwatchlogs.SearchedLogStream{
+			LogStreamName:      aws.String(s.name),
+			SearchedCompletely: aws.Bool(true),
+		})
+	}
+
+	for i := range events {
+		e := events[i]
+		if after != nil && !less(after, e.event) {
+			continue
+		}
+		if len(out.Events) == limit {
+			last := out.Events[len(out.Events)-1]
+			out.NextToken = aws.String(fmt.Sprintf("%d/%s", *last.Timestamp, *last.EventId))
+			break
+		}
+		out.Events = append(out.Events, &cloudwatchlogs.FilteredLogEvent{
+			EventId:       aws.String(e.id),
+			IngestionTime: aws.Int64(e.ingestion),
+			LogStreamName: aws.String(e.stream),
+			Message:       aws.String(e.message),
+			Timestamp:     aws.Int64(e.timestamp),
+		})
+	}
+	return out, nil
+}
+
+// parseFilterToken decodes a FilterLogEvents token, which is the timestamp
+// and ID of the last event returned.
+func parseFilterToken(token string) (*event, error) {
+	invalid := invalidParameter("The specified nextToken is invalid.")
+	i := strings.IndexByte(token, '/')
+	if i < 0 {
+		return nil, invalid
+	}
+	timestamp, err := strconv.ParseInt(token[:i], 10, 64)
+	if err != nil {
+		return nil, invalid
+	}
+	return &event{timestamp: timestamp, id: token[i+1:]}, nil
+}
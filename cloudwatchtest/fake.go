@@ -0,0 +1,504 @@
+// Package cloudwatchtest provides an in-memory CloudWatch Logs backend for
+// tests.
+//
+// A Fake implements cloudwatchlogsiface.CloudWatchLogsAPI, so it can be
+// passed anywhere a *cloudwatchlogs.CloudWatchLogs would be. Unlike a mock, it
+// keeps state: it holds log groups, streams and events, issues and checks
+// sequence tokens, and enforces the limits that CloudWatch Logs puts on
+// requests, so code under test sees the same errors it would see in
+// production.
+package cloudwatchtest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+)
+
+// ThrottlingCode is the error code CloudWatch Logs uses when a request is
+// rate limited.
+const ThrottlingCode = "ThrottlingException"
+
+// The default and maximum page sizes of the Describe operations.
+const (
+	defaultDescribeLimit = 50
+	maximumDescribeLimit = 50
+)
+
+// Fake is an in-memory CloudWatch Logs backend. The zero value isn't usable,
+// use New.
+//
+// Operations that the Fake doesn't implement panic. A Fake is safe for
+// concurrent use.
+type Fake struct {
+	// CloudWatchLogsAPI is embedded so that Fake satisfies the interface.
+	// It is nil, so calling an operation that isn't implemented panics.
+	cloudwatchlogsiface.CloudWatchLogsAPI
+
+	// Now returns the current time, which is used for ingestion times,
+	// creation times and to decide whether events are too old or too new.
+	// It defaults to time.Now, and can be replaced to control the clock.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	groups   map[string]*group
+	failures map[string][]error
+	calls    map[string]int
+	ids      int64
+	tokens   int64
+}
+
+type group struct {
+	name    string
+	created int64
+	streams map[string]*stream
+}
+
+type stream struct {
+	name    string
+	created int64
+	events  []*event
+
+	// token is the sequence token the next PutLogEvents must use. It is nil
+	// until the first events are put.
+	token *string
+
+	// The token and contents of the last accepted batch, to detect batches
+	// that are sent twice.
+	lastToken *string
+	lastBatch string
+}
+
+type event struct {
+	id        string
+	timestamp int64
+	ingestion int64
+	message   string
+}
+
+// New returns an empty Fake.
+func New() *Fake {
+	return &Fake{
+		Now:      time.Now,
+		groups:   make(map[string]*group),
+		failures: make(map[string][]error),
+		calls:    make(map[string]int),
+	}
+}
+
+// Fail makes the next n calls to the operation op, such as "PutLogEvents",
+// return err instead of doing anything. Failures queued by successive calls
+// are returned in order.
+func (f *Fake) Fail(op string, n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := 0; i < n; i++ {
+		f.failures[op] = append(f.failures[op], err)
+	}
+}
+
+// Throttle makes the next n calls to the operation op fail with a
+// ThrottlingException.
+func (f *Fake) Throttle(op string, n int) {
+	f.Fail(op, n, awserr.New(ThrottlingCode, "Rate exceeded", nil))
+}
+
+// Calls returns the number of times the operation op has been called,
+// including calls that failed.
+func (f *Fake) Calls(op string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.calls[op]
+}
+
+// Events returns the events in a stream, in the order they were put. It
+// returns nil if the stream doesn't exist.
+func (f *Fake) Events(groupName, streamName string) []*cloudwatchlogs.OutputLogEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	g, ok := f.groups[groupName]
+	if !ok {
+		return nil
+	}
+	s, ok := g.streams[streamName]
+	if !ok {
+		return nil
+	}
+
+	events := make([]*cloudwatchlogs.OutputLogEvent, len(s.events))
+	for i, e := range s.events {
+		events[i] = e.output()
+	}
+	return events
+}
+
+// Messages returns the messages of the events in a stream, in the order they
+// were put.
+func (f *Fake) Messages(groupName, streamName string) []string {
+	var messages []string
+	for _, e := range f.Events(groupName, streamName) {
+		messages = append(messages, *e.Message)
+	}
+	return messages
+}
+
+// call records a call to op, and returns the error it should fail with, if
+// any. f.mu must be held.
+func (f *Fake) call(ctx aws.Context, op string) error {
+	f.calls[op]++
+
+	if err := ctx.Err(); err != nil {
+		return awserr.New(request.CanceledErrorCode, "request context canceled", err)
+	}
+
+	if failures := f.failures[op]; len(failures) > 0 {
+		f.failures[op] = failures[1:]
+		return failures[0]
+	}
+	return nil
+}
+
+func (f *Fake) now() int64 {
+	return f.Now().UnixNano() / int64(time.Millisecond)
+}
+
+func (f *Fake) nextToken() *string {
+	f.tokens++
+	return aws.String(fmt.Sprintf("%056d", f.tokens))
+}
+
+func (f *Fake) nextID() string {
+	f.ids++
+	return fmt.Sprintf("%056d", f.ids)
+}
+
+// lookup returns the named group and stream. f.mu must be held.
+func (f *Fake) lookup(groupName, streamName *string) (*group, *stream, error) {
+	if groupName == nil {
+		return nil, nil, invalidParameter("logGroupName is required")
+	}
+	g, ok := f.groups[*groupName]
+	if !ok {
+		return nil, nil, notFound("The specified log group does not exist.")
+	}
+	if streamName == nil {
+		return g, nil, nil
+	}
+	s, ok := g.streams[*streamName]
+	if !ok {
+		return g, nil, notFound("The specified log stream does not exist.")
+	}
+	return g, s, nil
+}
+
+func (f *Fake) CreateLogGroup(input *cloudwatchlogs.CreateLogGroupInput) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+	return f.CreateLogGroupWithContext(aws.BackgroundContext(), input)
+}
+
+func (f *Fake) CreateLogGroupWithContext(ctx aws.Context, input *cloudwatchlogs.CreateLogGroupInput, _ ...request.Option) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call(ctx, "CreateLogGroup"); err != nil {
+		return nil, err
+	}
+
+	name := aws.StringValue(input.LogGroupName)
+	if name == "" {
+		return nil, invalidParameter("logGroupName is required")
+	}
+	if _, ok := f.groups[name]; ok {
+		return nil, awserr.New(cloudwatchlogs.ErrCodeResourceAlreadyExistsException, "The specified log group already exists", nil)
+	}
+
+	f.groups[name] = &group{
+		name:    name,
+		created: f.now(),
+		streams: make(map[string]*stream),
+	}
+	return &cloudwatchlogs.CreateLogGroupOutput{}, nil
+}
+
+func (f *Fake) DeleteLogGroup(input *cloudwatchlogs.DeleteLogGroupInput) (*cloudwatchlogs.DeleteLogGroupOutput, error) {
+	return f.DeleteLogGroupWithContext(aws.BackgroundContext(), input)
+}
+
+func (f *Fake) DeleteLogGroupWithContext(ctx aws.Context, input *cloudwatchlogs.DeleteLogGroupInput, _ ...request.Option) (*cloudwatchlogs.DeleteLogGroupOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call(ctx, "DeleteLogGroup"); err != nil {
+		return nil, err
+	}
+
+	g, _, err := f.lookup(input.LogGroupName, nil)
+	if err != nil {
+		return nil, err
+	}
+	delete(f.groups, g.name)
+	return &cloudwatchlogs.DeleteLogGroupOutput{}, nil
+}
+
+func (f *Fake) DescribeLogGroups(input *cloudwatchlogs.DescribeLogGroupsInput) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+	return f.DescribeLogGroupsWithContext(aws.BackgroundContext(), input)
+}
+
+func (f *Fake) DescribeLogGroupsWithContext(ctx aws.Context, input *cloudwatchlogs.DescribeLogGroupsInput, _ ...request.Option) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call(ctx, "DescribeLogGroups"); err != nil {
+		return nil, err
+	}
+
+	limit, err := describeLimit(input.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range f.groups {
+		if strings.HasPrefix(name, aws.StringValue(input.LogGroupNamePrefix)) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	start, err := offset(input.NextToken)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &cloudwatchlogs.DescribeLogGroupsOutput{}
+	for i := start; i < len(names); i++ {
+		if len(out.LogGroups) == limit {
+			out.NextToken = aws.String(strconv.Itoa(i))
+			break
+		}
+
+		g := f.groups[names[i]]
+		var stored int64
+		for _, s := range g.streams {
+			for _, e := range s.events {
+				stored += int64(len(e.message))
+			}
+		}
+		out.LogGroups = append(out.LogGroups, &cloudwatchlogs.LogGroup{
+			Arn:          aws.String("arn:aws:logs:local:000000000000:log-group:" + g.name + ":*"),
+			CreationTime: aws.Int64(g.created),
+			LogGroupName: aws.String(g.name),
+			StoredBytes:  aws.Int64(stored),
+		})
+	}
+	return out, nil
+}
+
+func (f *Fake) CreateLogStream(input *cloudwatchlogs.CreateLogStreamInput) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+	return f.CreateLogStreamWithContext(aws.BackgroundContext(), input)
+}
+
+func (f *Fake) CreateLogStreamWithContext(ctx aws.Context, input *cloudwatchlogs.CreateLogStreamInput, _ ...request.Option) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call(ctx, "CreateLogStream"); err != nil {
+		return nil, err
+	}
+
+	g, _, err := f.lookup(input.LogGroupName, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	name := aws.StringValue(input.LogStreamName)
+	if name == "" {
+		return nil, invalidParameter("logStreamName is required")
+	}
+	if strings.ContainsAny(name, ":*") {
+		return nil, invalidParameter("logStreamName must not contain ':' or '*'")
+	}
+	if _, ok := g.streams[name]; ok {
+		return nil, awserr.New(cloudwatchlogs.ErrCodeResourceAlreadyExistsException, "The specified log stream already exists", nil)
+	}
+
+	g.streams[name] = &stream{name: name, created: f.now()}
+	return &cloudwatchlogs.CreateLogStreamOutput{}, nil
+}
+
+func (f *Fake) DeleteLogStream(input *cloudwatchlogs.DeleteLogStreamInput) (*cloudwatchlogs.DeleteLogStreamOutput, error) {
+	return f.DeleteLogStreamWithContext(aws.BackgroundContext(), input)
+}
+
+func (f *Fake) DeleteLogStreamWithContext(ctx aws.Context, input *cloudwatchlogs.DeleteLogStreamInput, _ ...request.Option) (*cloudwatchlogs.DeleteLogStreamOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call(ctx, "DeleteLogStream"); err != nil {
+		return nil, err
+	}
+
+	if input.LogStreamName == nil {
+		return nil, invalidParameter("logStreamName is required")
+	}
+	g, s, err := f.lookup(input.LogGroupName, input.LogStreamName)
+	if err != nil {
+		return nil, err
+	}
+	delete(g.streams, s.name)
+	return &cloudwatchlogs.DeleteLogStreamOutput{}, nil
+}
+
+func (f *Fake) DescribeLogStreams(input *cloudwatchlogs.DescribeLogStreamsInput) (*cloudwatchlogs.DescribeLogStreamsOutput, error) {
+	return f.DescribeLogStreamsWithContext(aws.BackgroundContext(), input)
+}
+
+func (f *Fake) DescribeLogStreamsWithContext(ctx aws.Context, input *cloudwatchlogs.DescribeLogStreamsInput, _ ...request.Option) (*cloudwatchlogs.DescribeLogStreamsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call(ctx, "DescribeLogStreams"); err != nil {
+		return nil, err
+	}
+
+	g, _, err := f.lookup(input.LogGroupName, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	limit, err := describeLimit(input.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	orderBy := aws.StringValue(input.OrderBy)
+	if orderBy == "" {
+		orderBy = cloudwatchlogs.OrderByLogStreamName
+	}
+	if orderBy != cloudwatchlogs.OrderByLogStreamName && orderBy != cloudwatchlogs.OrderByLastEventTime {
+		return nil, invalidParameter("orderBy must be LogStreamName or LastEventTime")
+	}
+	if orderBy == cloudwatchlogs.OrderByLastEventTime && input.LogStreamNamePrefix != nil {
+		return nil, invalidParameter("Cannot order by LastEventTime with a logStreamNamePrefix.")
+	}
+
+	var streams []*stream
+	for _, s := range g.streams {
+		if strings.HasPrefix(s.name, aws.StringValue(input.LogStreamNamePrefix)) {
+			streams = append(streams, s)
+		}
+	}
+	sort.Slice(streams, func(i, j int) bool {
+		if orderBy == cloudwatchlogs.OrderByLastEventTime {
+			ti, tj := streams[i].lastEventTime(), streams[j].lastEventTime()
+			if ti != tj {
+				return ti < tj
+			}
+		}
+		return streams[i].name < streams[j].name
+	})
+	if aws.BoolValue(input.Descending) {
+		for i, j := 0, len(streams)-1; i < j; i, j = i+1, j-1 {
+			streams[i], streams[j] = streams[j], streams[i]
+		}
+	}
+
+	start, err := offset(input.NextToken)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &cloudwatchlogs.DescribeLogStreamsOutput{}
+	for i := start; i < len(streams); i++ {
+		if len(out.LogStreams) == limit {
+			out.NextToken = aws.String(strconv.Itoa(i))
+			break
+		}
+		out.LogStreams = append(out.LogStreams, streams[i].describe(g))
+	}
+	return out, nil
+}
+
+func (s *stream) lastEventTime() int64 {
+	var last int64
+	for _, e := range s.events {
+		if e.timestamp > last {
+			last = e.timestamp
+		}
+	}
+	return last
+}
+
+func (s *stream) describe(g *group) *cloudwatchlogs.LogStream {
+	out := &cloudwatchlogs.LogStream{
+		Arn:                 aws.String("arn:aws:logs:local:000000000000:log-group:" + g.name + ":log-stream:" + s.name),
+		CreationTime:        aws.Int64(s.created),
+		LogStreamName:       aws.String(s.name),
+		UploadSequenceToken: s.token,
+	}
+	if len(s.events) > 0 {
+		first := s.events[0].timestamp
+		var stored int64
+		for _, e := range s.events {
+			if e.timestamp < first {
+				first = e.timestamp
+			}
+			stored += int64(len(e.message))
+		}
+		out.FirstEventTimestamp = aws.Int64(first)
+		out.LastEventTimestamp = aws.Int64(s.lastEventTime())
+		out.LastIngestionTime = aws.Int64(s.events[len(s.events)-1].ingestion)
+		out.StoredBytes = aws.Int64(stored)
+	}
+	return out
+}
+
+func (e *event) output() *cloudwatchlogs.OutputLogEvent {
+	return &cloudwatchlogs.OutputLogEvent{
+		IngestionTime: aws.Int64(e.ingestion),
+		Message:       aws.String(e.message),
+		Timestamp:     aws.Int64(e.timestamp),
+	}
+}
+
+func describeLimit(limit *int64) (int, error) {
+	if limit == nil {
+		return defaultDescribeLimit, nil
+	}
+	if *limit < 1 || *limit > maximumDescribeLimit {
+		return 0, invalidParameter("limit must be between 1 and %d", maximumDescribeLimit)
+	}
+	return int(*limit), nil
+}
+
+// offset decodes the pagination tokens of the Describe operations, which are
+// the index of the next item.
+func offset(token *string) (int, error) {
+	if token == nil {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(*token)
+	if err != nil || i < 0 {
+		return 0, invalidParameter("The specified nextToken is invalid.")
+	}
+	return i, nil
+}
+
+func invalidParameter(format string, args ...interface{}) error {
+	return awserr.New(cloudwatchlogs.ErrCodeInvalidParameterException, fmt.Sprintf(format, args...), nil)
+}
+
+func notFound(message string) error {
+	return awserr.New(cloudwatchlogs.ErrCodeResourceNotFoundException, message, nil)
+}
@@ -0,0 +1,312 @@
+package cloudwatchtest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFake(t *testing.T, streams ...string) *Fake {
+	f := New()
+	f.Now = func() time.Time { return time.Unix(1000, 0) }
+
+	_, err := f.CreateLogGroup(&cloudwatchlogs.CreateLogGroupInput{LogGroupName: aws.String("group")})
+	assert.NoError(t, err)
+	for _, stream := range streams {
+		_, err := f.CreateLogStream(&cloudwatchlogs.CreateLogStreamInput{
+			LogGroupName:  aws.String("group"),
+			LogStreamName: aws.String(stream),
+		})
+		assert.NoError(t, err)
+	}
+	return f
+}
+
+func put(f *Fake, stream string, token *string, messages ...string) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	var events []*cloudwatchlogs.InputLogEvent
+	for i, message := range messages {
+		events = append(events, &cloudwatchlogs.InputLogEvent{
+			Message:   aws.String(message),
+			Timestamp: aws.Int64(1000000 + int64(i)),
+		})
+	}
+	return f.PutLogEvents(&cloudwatchlogs.PutLogEventsInput{
+		LogEvents:     events,
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String(stream),
+		SequenceToken: token,
+	})
+}
+
+func errCode(err error) string {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code()
+	}
+	return ""
+}
+
+func TestFake_Groups(t *testing.T) {
+	f := newFake(t, "1234")
+
+	_, err := f.CreateLogGroup(&cloudwatchlogs.CreateLogGroupInput{LogGroupName: aws.String("group")})
+	assert.Equal(t, cloudwatchlogs.ErrCodeResourceAlreadyExistsException, errCode(err))
+
+	_, err = f.CreateLogStream(&cloudwatchlogs.CreateLogStreamInput{
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	})
+	assert.Equal(t, cloudwatchlogs.ErrCodeResourceAlreadyExistsException, errCode(err))
+
+	_, err = f.CreateLogStream(&cloudwatchlogs.CreateLogStreamInput{
+		LogGroupName:  aws.String("missing"),
+		LogStreamName: aws.String("1234"),
+	})
+	assert.Equal(t, cloudwatchlogs.ErrCodeResourceNotFoundException, errCode(err))
+
+	resp, err := f.DescribeLogGroups(&cloudwatchlogs.DescribeLogGroupsInput{LogGroupNamePrefix: aws.String("gr")})
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(resp.LogGroups)) {
+		assert.Equal(t, "group", *resp.LogGroups[0].LogGroupName)
+	}
+}
+
+func TestFake_SequenceTokens(t *testing.T) {
+	f := newFake(t, "1234")
+
+	resp, err := put(f, "1234", nil, "first")
+	assert.NoError(t, err)
+	token := resp.NextSequenceToken
+
+	// Sending the same batch again is detected.
+	_, err = put(f, "1234", nil, "first")
+	assert.Equal(t, cloudwatchlogs.ErrCodeDataAlreadyAcceptedException, errCode(err))
+	assert.True(t, strings.HasSuffix(err.(awserr.Error).Message(), " "+*token))
+
+	// A stale token is rejected, with the one that was expected.
+	_, err = put(f, "1234", nil, "second")
+	assert.Equal(t, cloudwatchlogs.ErrCodeInvalidSequenceTokenException, errCode(err))
+	assert.True(t, strings.HasSuffix(err.(awserr.Error).Message(), " "+*token))
+
+	_, err = put(f, "1234", token, "second")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"first", "second"}, f.Messages("group", "1234"))
+}
+
+func TestFake_Limits(t *testing.T) {
+	f := newFake(t, "1234")
+
+	_, err := f.PutLogEvents(&cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("b"), Timestamp: aws.Int64(1000000)},
+			{Message: aws.String("a"), Timestamp: aws.Int64(999999)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	})
+	assert.Equal(t, cloudwatchlogs.ErrCodeInvalidParameterException, errCode(err))
+
+	_, err = put(f, "1234", nil, strings.Repeat("a", maximumBytesPerEvent+1))
+	assert.Equal(t, cloudwatchlogs.ErrCodeInvalidParameterException, errCode(err))
+
+	var messages []string
+	for i := 0; i < 5; i++ {
+		messages = append(messages, strings.Repeat("a", maximumBytesPerEvent))
+	}
+	_, err = put(f, "1234", nil, messages...)
+	assert.Equal(t, cloudwatchlogs.ErrCodeInvalidParameterException, errCode(err))
+
+	assert.Empty(t, f.Messages("group", "1234"))
+}
+
+func TestFake_Rejected(t *testing.T) {
+	f := newFake(t, "1234")
+	now := f.Now().UnixNano() / int64(time.Millisecond)
+
+	resp, err := f.PutLogEvents(&cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("old"), Timestamp: aws.Int64(now - maximumEventAge - 1)},
+			{Message: aws.String("now"), Timestamp: aws.Int64(now - maximumEventAge + 1)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &cloudwatchlogs.RejectedLogEventsInfo{
+		TooOldLogEventEndIndex: aws.Int64(1),
+	}, resp.RejectedLogEventsInfo)
+
+	resp, err = f.PutLogEvents(&cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("soon"), Timestamp: aws.Int64(now + maximumEventFuture)},
+			{Message: aws.String("new"), Timestamp: aws.Int64(now + maximumEventFuture + 1)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+		SequenceToken: resp.NextSequenceToken,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &cloudwatchlogs.RejectedLogEventsInfo{
+		TooNewLogEventStartIndex: aws.Int64(1),
+	}, resp.RejectedLogEventsInfo)
+
+	assert.Equal(t, []string{"now", "soon"}, f.Messages("group", "1234"))
+}
+
+func TestFake_GetLogEvents(t *testing.T) {
+	f := newFake(t, "1234")
+
+	_, err := put(f, "1234", nil, "a", "b", "c")
+	assert.NoError(t, err)
+
+	get := func(input *cloudwatchlogs.GetLogEventsInput) ([]string, *cloudwatchlogs.GetLogEventsOutput) {
+		input.LogGroupName = aws.String("group")
+		input.LogStreamName = aws.String("1234")
+		resp, err := f.GetLogEvents(input)
+		assert.NoError(t, err)
+
+		var messages []string
+		for _, e := range resp.Events {
+			messages = append(messages, *e.Message)
+		}
+		return messages, resp
+	}
+
+	messages, resp := get(&cloudwatchlogs.GetLogEventsInput{StartFromHead: aws.Bool(true), Limit: aws.Int64(2)})
+	assert.Equal(t, []string{"a", "b"}, messages)
+
+	messages, resp = get(&cloudwatchlogs.GetLogEventsInput{StartFromHead: aws.Bool(true), NextToken: resp.NextForwardToken})
+	assert.Equal(t, []string{"c"}, messages)
+
+	// At the end of the stream the forward token doesn't change.
+	forward := resp.NextForwardToken
+	messages, resp = get(&cloudwatchlogs.GetLogEventsInput{StartFromHead: aws.Bool(true), NextToken: forward})
+	assert.Empty(t, messages)
+	assert.Equal(t, forward, resp.NextForwardToken)
+
+	messages, resp = get(&cloudwatchlogs.GetLogEventsInput{NextToken: resp.NextBackwardToken, Limit: aws.Int64(2)})
+	assert.Equal(t, []string{"b", "c"}, messages)
+
+	messages, _ = get(&cloudwatchlogs.GetLogEventsInput{NextToken: resp.NextBackwardToken})
+	assert.Equal(t, []string{"a"}, messages)
+
+	// Without a token, the tail of the stream is returned.
+	messages, _ = get(&cloudwatchlogs.GetLogEventsInput{Limit: aws.Int64(1)})
+	assert.Equal(t, []string{"c"}, messages)
+
+	messages, _ = get(&cloudwatchlogs.GetLogEventsInput{StartTime: aws.Int64(1000001), EndTime: aws.Int64(1000002)})
+	assert.Equal(t, []string{"b"}, messages)
+
+	_, err = f.GetLogEvents(&cloudwatchlogs.GetLogEventsInput{
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+		NextToken:     aws.String("nonsense"),
+	})
+	assert.Equal(t, cloudwatchlogs.ErrCodeInvalidParameterException, errCode(err))
+
+	// Forward tokens have to be used with StartFromHead.
+	_, err = f.GetLogEvents(&cloudwatchlogs.GetLogEventsInput{
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+		NextToken:     forward,
+	})
+	assert.Equal(t, cloudwatchlogs.ErrCodeInvalidParameterException, errCode(err))
+}
+
+func TestFake_FilterLogEvents(t *testing.T) {
+	f := newFake(t, "a", "b", "other")
+
+	_, err := put(f, "a", nil, "ERROR one", "INFO two")
+	assert.NoError(t, err)
+	_, err = put(f, "b", nil, "ERROR three", "WARN four")
+	assert.NoError(t, err)
+	_, err = put(f, "other", nil, "ERROR five")
+	assert.NoError(t, err)
+
+	filter := func(input *cloudwatchlogs.FilterLogEventsInput) ([]string, *string) {
+		input.LogGroupName = aws.String("group")
+		resp, err := f.FilterLogEvents(input)
+		assert.NoError(t, err)
+
+		var messages []string
+		for _, e := range resp.Events {
+			messages = append(messages, *e.LogStreamName+": "+*e.Message)
+		}
+		return messages, resp.NextToken
+	}
+
+	messages, _ := filter(&cloudwatchlogs.FilterLogEventsInput{
+		LogStreamNames: aws.StringSlice([]string{"a", "b"}),
+		FilterPattern:  aws.String("?ERROR ?WARN"),
+	})
+	assert.Equal(t, []string{"a: ERROR one", "b: ERROR three", "b: WARN four"}, messages)
+
+	messages, next := filter(&cloudwatchlogs.FilterLogEventsInput{
+		FilterPattern: aws.String("ERROR"),
+		Limit:         aws.Int64(2),
+	})
+	assert.Equal(t, []string{"a: ERROR one", "b: ERROR three"}, messages)
+
+	messages, next = filter(&cloudwatchlogs.FilterLogEventsInput{
+		FilterPattern: aws.String("ERROR"),
+		Limit:         aws.Int64(2),
+		NextToken:     next,
+	})
+	assert.Equal(t, []string{"other: ERROR five"}, messages)
+	assert.Nil(t, next)
+
+	messages, _ = filter(&cloudwatchlogs.FilterLogEventsInput{
+		LogStreamNamePrefix: aws.String("o"),
+	})
+	assert.Equal(t, []string{"other: ERROR five"}, messages)
+
+	messages, _ = filter(&cloudwatchlogs.FilterLogEventsInput{
+		FilterPattern: aws.String("[level = WARN, ...]"),
+	})
+	assert.Equal(t, []string{"b: WARN four"}, messages)
+
+	_, err = f.FilterLogEvents(&cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:  aws.String("group"),
+		FilterPattern: aws.String(`{ $.level = }`),
+	})
+	assert.Equal(t, cloudwatchlogs.ErrCodeInvalidParameterException, errCode(err))
+}
+
+func TestFake_Fail(t *testing.T) {
+	f := newFake(t, "1234")
+
+	errBoom := errors.New("boom")
+	f.Fail("PutLogEvents", 1, errBoom)
+	f.Throttle("PutLogEvents", 1)
+
+	_, err := put(f, "1234", nil, "a")
+	assert.Equal(t, errBoom, err)
+
+	_, err = put(f, "1234", nil, "a")
+	assert.Equal(t, ThrottlingCode, errCode(err))
+
+	_, err = put(f, "1234", nil, "a")
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, f.Calls("PutLogEvents"))
+}
+
+func TestFake_Context(t *testing.T) {
+	f := newFake(t, "1234")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := f.GetLogEventsWithContext(ctx, &cloudwatchlogs.GetLogEventsInput{
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	})
+	assert.Error(t, err)
+}
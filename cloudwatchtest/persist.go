@@ -0,0 +1,117 @@
+package cloudwatchtest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// savedState is how the contents of a Fake are encoded by Save.
+type savedState struct {
+	IDs    int64        `json:"ids"`
+	Tokens int64        `json:"tokens"`
+	Groups []savedGroup `json:"groups"`
+}
+
+type savedGroup struct {
+	Name    string        `json:"name"`
+	Created int64         `json:"created"`
+	Streams []savedStream `json:"streams"`
+}
+
+type savedStream struct {
+	Name    string       `json:"name"`
+	Created int64        `json:"created"`
+	Token   *string      `json:"token,omitempty"`
+	Events  []savedEvent `json:"events"`
+}
+
+type savedEvent struct {
+	ID        string `json:"id"`
+	Timestamp int64  `json:"t"`
+	Ingestion int64  `json:"i"`
+	Message   string `json:"m"`
+}
+
+// Save writes the groups, streams and events in f to the file at path. The
+// file is replaced atomically, so a crash part way through leaves the
+// previous contents in place.
+func (f *Fake) Save(path string) error {
+	f.mu.Lock()
+	state := savedState{IDs: f.ids, Tokens: f.tokens}
+	for _, g := range f.groups {
+		sg := savedGroup{Name: g.name, Created: g.created}
+		for _, s := range g.streams {
+			ss := savedStream{Name: s.name, Created: s.created, Token: s.token}
+			for _, e := range s.events {
+				ss.Events = append(ss.Events, savedEvent{e.id, e.timestamp, e.ingestion, e.message})
+			}
+			sg.Streams = append(sg.Streams, ss)
+		}
+		state.Groups = append(state.Groups, sg)
+	}
+	f.mu.Unlock()
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Load replaces the contents of f with those saved to the file at path by
+// Save. If the file doesn't exist, f is left as it is.
+func (f *Fake) Load(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var state savedState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return err
+	}
+
+	groups := make(map[string]*group)
+	for _, sg := range state.Groups {
+		g := &group{name: sg.Name, created: sg.Created, streams: make(map[string]*stream)}
+		for _, ss := range sg.Streams {
+			s := &stream{name: ss.Name, created: ss.Created, token: ss.Token}
+			for _, e := range ss.Events {
+				s.events = append(s.events, &event{e.ID, e.Timestamp, e.Ingestion, e.Message})
+			}
+			g.streams[s.name] = s
+		}
+		groups[g.name] = g
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.groups = groups
+	f.ids = state.IDs
+	f.tokens = state.Tokens
+	return nil
+}
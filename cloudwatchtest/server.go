@@ -0,0 +1,210 @@
+package cloudwatchtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// targetPrefix is the prefix of the X-Amz-Target header of CloudWatch Logs
+// requests. The rest of the header is the name of the operation.
+const targetPrefix = "Logs_20140328."
+
+// operation decodes the body of a request, and performs it on a Fake.
+type operation func(ctx aws.Context, body []byte) (interface{}, error)
+
+// NewHandler returns an http.Handler that serves the CloudWatch Logs JSON
+// API from f. It supports CreateLogGroup, DeleteLogGroup, DescribeLogGroups,
+// CreateLogStream, DeleteLogStream, DescribeLogStreams, PutLogEvents,
+// GetLogEvents and FilterLogEvents.
+//
+// Requests aren't authenticated, so any region and credentials can be used.
+func NewHandler(f *Fake) http.Handler {
+	ops := map[string]operation{
+		"CreateLogGroup": func(ctx aws.Context, body []byte) (interface{}, error) {
+			input := &cloudwatchlogs.CreateLogGroupInput{}
+			if err := decode(body, input); err != nil {
+				return nil, err
+			}
+			return f.CreateLogGroupWithContext(ctx, input)
+		},
+		"DeleteLogGroup": func(ctx aws.Context, body []byte) (interface{}, error) {
+			input := &cloudwatchlogs.DeleteLogGroupInput{}
+			if err := decode(body, input); err != nil {
+				return nil, err
+			}
+			return f.DeleteLogGroupWithContext(ctx, input)
+		},
+		"DescribeLogGroups": func(ctx aws.Context, body []byte) (interface{}, error) {
+			input := &cloudwatchlogs.DescribeLogGroupsInput{}
+			if err := decode(body, input); err != nil {
+				return nil, err
+			}
+			return f.DescribeLogGroupsWithContext(ctx, input)
+		},
+		"CreateLogStream": func(ctx aws.Context, body []byte) (interface{}, error) {
+			input := &cloudwatchlogs.CreateLogStreamInput{}
+			if err := decode(body, input); err != nil {
+				return nil, err
+			}
+			return f.CreateLogStreamWithContext(ctx, input)
+		},
+		"DeleteLogStream": func(ctx aws.Context, body []byte) (interface{}, error) {
+			input := &cloudwatchlogs.DeleteLogStreamInput{}
+			if err := decode(body, input); err != nil {
+				return nil, err
+			}
+			return f.DeleteLogStreamWithContext(ctx, input)
+		},
+		"DescribeLogStreams": func(ctx aws.Context, body []byte) (interface{}, error) {
+			input := &cloudwatchlogs.DescribeLogStreamsInput{}
+			if err := decode(body, input); err != nil {
+				return nil, err
+			}
+			return f.DescribeLogStreamsWithContext(ctx, input)
+		},
+		"PutLogEvents": func(ctx aws.Context, body []byte) (interface{}, error) {
+			input := &cloudwatchlogs.PutLogEventsInput{}
+			if err := decode(body, input); err != nil {
+				return nil, err
+			}
+			return f.PutLogEventsWithContext(ctx, input)
+		},
+		"GetLogEvents": func(ctx aws.Context, body []byte) (interface{}, error) {
+			input := &cloudwatchlogs.GetLogEventsInput{}
+			if err := decode(body, input); err != nil {
+				return nil, err
+			}
+			return f.GetLogEventsWithContext(ctx, input)
+		},
+		"FilterLogEvents": func(ctx aws.Context, body []byte) (interface{}, error) {
+			input := &cloudwatchlogs.FilterLogEventsInput{}
+			if err := decode(body, input); err != nil {
+				return nil, err
+			}
+			return f.FilterLogEventsWithContext(ctx, input)
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, awserr.New("UnknownOperationException", "Only POST requests are supported", nil))
+			return
+		}
+
+		target := r.Header.Get("X-Amz-Target")
+		op, ok := ops[strings.TrimPrefix(target, targetPrefix)]
+		if !ok || !strings.HasPrefix(target, targetPrefix) {
+			writeError(w, awserr.New("UnknownOperationException", "Unknown operation "+target, nil))
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, awserr.New("SerializationException", err.Error(), nil))
+			return
+		}
+
+		out, err := op(r.Context(), body)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		b, err := encode(out)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		w.Write(b)
+	})
+}
+
+// NewServer starts and returns a server that serves the CloudWatch Logs
+// JSON API from f. Point an SDK at it by using the server's URL as the
+// endpoint. The caller should call Close when finished, to shut it down.
+func NewServer(f *Fake) *httptest.Server {
+	return httptest.NewServer(NewHandler(f))
+}
+
+// decode decodes the JSON body of a request into input. The fields in the
+// body are lower camel case, but encoding/json matches them to the SDK's
+// field names regardless of case.
+func decode(body []byte, input interface{}) error {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(body, input); err != nil {
+		return awserr.New("SerializationException", err.Error(), nil)
+	}
+	return nil
+}
+
+// encode encodes an SDK output struct as the service would, with lower camel
+// case field names and without null fields.
+func encode(out interface{}) ([]byte, error) {
+	b, err := json.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(wireFormat(v))
+}
+
+func wireFormat(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			if value == nil {
+				continue
+			}
+			r, size := utf8.DecodeRuneInString(key)
+			m[string(unicode.ToLower(r))+key[size:]] = wireFormat(value)
+		}
+		return m
+	case []interface{}:
+		for i, value := range v {
+			v[i] = wireFormat(value)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// writeError writes err as the service would. Errors that aren't
+// awserr.Errors are reported as internal failures.
+func writeError(w http.ResponseWriter, err error) {
+	code, message, status := "InternalFailure", err.Error(), http.StatusInternalServerError
+	if awsErr, ok := err.(awserr.Error); ok {
+		code, message, status = awsErr.Code(), awsErr.Message(), http.StatusBadRequest
+		if code == cloudwatchlogs.ErrCodeServiceUnavailableException {
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	b, _ := json.Marshal(map[string]string{
+		"__type":  code,
+		"message": message,
+	})
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.WriteHeader(status)
+	w.Write(b)
+}
@@ -0,0 +1,119 @@
+package cloudwatchtest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func post(t *testing.T, url, op, body string) (int, map[string]interface{}) {
+	req, err := http.NewRequest("POST", url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Amz-Target", targetPrefix+op)
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var out map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, out
+}
+
+func TestServer(t *testing.T) {
+	f := newFake(t, "1234")
+	s := NewServer(f)
+	defer s.Close()
+
+	status, out := post(t, s.URL, "PutLogEvents", `{
+		"logGroupName": "group",
+		"logStreamName": "1234",
+		"logEvents": [{"timestamp": 1000000, "message": "Hello"}]
+	}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotEmpty(t, out["nextSequenceToken"])
+	assert.NotContains(t, out, "rejectedLogEventsInfo")
+
+	status, out = post(t, s.URL, "GetLogEvents", `{
+		"logGroupName": "group",
+		"logStreamName": "1234",
+		"startFromHead": true
+	}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"timestamp": 1000000.0, "ingestionTime": 1000000.0, "message": "Hello"},
+	}, out["events"])
+
+	status, out = post(t, s.URL, "DescribeLogStreams", `{"logGroupName": "group"}`)
+	assert.Equal(t, http.StatusOK, status)
+	if streams, ok := out["logStreams"].([]interface{}); assert.True(t, ok) && assert.Equal(t, 1, len(streams)) {
+		assert.Equal(t, "1234", streams[0].(map[string]interface{})["logStreamName"])
+	}
+
+	status, out = post(t, s.URL, "FilterLogEvents", `{"logGroupName": "group", "filterPattern": "Hello"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 1, len(out["events"].([]interface{})))
+}
+
+func TestServer_Errors(t *testing.T) {
+	f := newFake(t)
+	s := NewServer(f)
+	defer s.Close()
+
+	status, out := post(t, s.URL, "CreateLogStream", `{"logGroupName": "missing", "logStreamName": "1234"}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "ResourceNotFoundException", out["__type"])
+	assert.Equal(t, "The specified log group does not exist.", out["message"])
+
+	status, out = post(t, s.URL, "TagLogGroup", `{}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "UnknownOperationException", out["__type"])
+
+	status, out = post(t, s.URL, "CreateLogGroup", `{`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "SerializationException", out["__type"])
+
+	f.Throttle("DescribeLogGroups", 1)
+	status, out = post(t, s.URL, "DescribeLogGroups", `{}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, ThrottlingCode, out["__type"])
+}
+
+func TestFake_SaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudwatchtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	f := newFake(t, "1234")
+	resp, err := put(f, "1234", nil, "Hello")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Save(path))
+
+	loaded := New()
+	loaded.Now = f.Now
+	assert.NoError(t, loaded.Load(path))
+	assert.Equal(t, f.Events("group", "1234"), loaded.Events("group", "1234"))
+
+	// The stream carries on from where it was saved.
+	_, err = put(loaded, "1234", resp.NextSequenceToken, "World")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Hello", "World"}, loaded.Messages("group", "1234"))
+
+	assert.NoError(t, New().Load(filepath.Join(dir, "missing.json")))
+}
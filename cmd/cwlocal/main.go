@@ -0,0 +1,118 @@
+// Command cwlocal serves the CloudWatch Logs JSON API on a local address, so
+// that services and integration tests can log without an AWS account. Point
+// an SDK at it by setting its endpoint, for example:
+//
+//	cwlocal -addr localhost:4586 -dir /tmp/cwlocal
+//	aws --endpoint-url http://localhost:4586 logs describe-log-groups
+//
+// Without -dir, everything is kept in memory and lost when cwlocal exits.
+// With it, the logs are saved to the directory every -save-every and on
+// exit, and loaded from it on start.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/eltorocorp/cloudwatch/cloudwatchtest"
+)
+
+const stateFile = "cwlocal.json"
+
+// mutating are the operations that change what would be saved.
+var mutating = map[string]bool{
+	"CreateLogGroup":  true,
+	"DeleteLogGroup":  true,
+	"CreateLogStream": true,
+	"DeleteLogStream": true,
+	"PutLogEvents":    true,
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:4586", "address to listen on")
+	dir := flag.String("dir", "", "directory to persist logs to (optional)")
+	saveEvery := flag.Duration("save-every", time.Second, "how often to save changes to -dir")
+	verbose := flag.Bool("v", false, "log every request")
+	flag.Parse()
+
+	f := cloudwatchtest.New()
+
+	var path string
+	if *dir != "" {
+		if err := os.MkdirAll(*dir, 0755); err != nil {
+			log.Fatal(err)
+		}
+		path = filepath.Join(*dir, stateFile)
+		if err := f.Load(path); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// dirty is set when a request may have changed what would be saved.
+	var dirty int32
+	handler := cloudwatchtest.NewHandler(f)
+	server := &http.Server{
+		Addr: *addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			op := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "Logs_20140328.")
+			if *verbose {
+				log.Println(op)
+			}
+			if mutating[op] {
+				atomic.StoreInt32(&dirty, 1)
+			}
+			handler.ServeHTTP(w, r)
+		}),
+	}
+
+	save := func() {
+		if path == "" || !atomic.CompareAndSwapInt32(&dirty, 1, 0) {
+			return
+		}
+		if err := f.Save(path); err != nil {
+			atomic.StoreInt32(&dirty, 1)
+			log.Println("error saving logs", err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+		ticker := time.NewTicker(*saveEvery)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				save()
+			case <-signals:
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				if err := server.Shutdown(ctx); err != nil {
+					log.Println("error shutting down", err)
+				}
+				save()
+				return
+			}
+		}
+	}()
+
+	log.Println("serving CloudWatch Logs on", *addr)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-done
+}
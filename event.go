@@ -0,0 +1,159 @@
+package cloudwatch
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+const (
+	// CloudWatch Logs rejects events that are older than 14 days or more than
+	// 2 hours in the future.
+	// See: http://docs.aws.amazon.com/AmazonCloudWatchLogs/latest/APIReference/API_PutLogEvents.html
+	maximumEventAge    = 14 * 24 * time.Hour
+	maximumEventFuture = 2 * time.Hour
+)
+
+// ErrEmptyMessage is returned by WriteEvents for events without a message,
+// which CloudWatch Logs won't accept.
+var ErrEmptyMessage = errors.New("cloudwatch: log events must have a message")
+
+// Event is a single log event.
+type Event struct {
+	// Timestamp is when the event occurred. If it is zero, the time the
+	// event is written is used.
+	Timestamp time.Time
+
+	Message string
+
+	// The rest of the fields are set on events returned by Reader.Next, and
+	// are ignored when writing.
+
+	// IngestionTime is when CloudWatch Logs received the event.
+	IngestionTime time.Time
+
+	// Stream is the name of the log stream the event was read from.
+	Stream string
+
+	// ID uniquely identifies the event within its log group. GetLogEvents
+	// doesn't return IDs, so it is only set on events found by
+	// FilterLogEvents.
+	ID string
+}
+
+// TimestampRangeError is returned when events have timestamps that CloudWatch
+// Logs won't accept. It is also passed to WriterOptions.OnDropped for
+// buffered events that became too old to send.
+type TimestampRangeError struct {
+	Events []Event
+}
+
+func (e *TimestampRangeError) Error() string {
+	return fmt.Sprintf("%d log events have timestamps more than %s old or %s in the future",
+		len(e.Events), maximumEventAge, maximumEventFuture)
+}
+
+// WriteEvent writes a single event, keeping its timestamp.
+func (w *Writer) WriteEvent(event Event) error {
+	return w.WriteEvents([]Event{event})
+}
+
+// WriteEvents writes events, keeping their timestamps. The events don't need
+// to be in chronological order.
+//
+// Events with timestamps that CloudWatch Logs won't accept are not written,
+// and are returned in a *TimestampRangeError once the rest have been. Events
+// with empty messages are skipped too, and ErrEmptyMessage returned. As with
+// Write, an error for events lost since the last call is returned once the
+// events have been buffered.
+func (w *Writer) WriteEvents(events []Event) error {
+	if atomic.LoadInt32(&w.closed) != 0 {
+		return io.ErrClosedPipe
+	}
+
+	var (
+		input   []*cloudwatchlogs.InputLogEvent
+		invalid []Event
+		empty   bool
+	)
+
+	for _, event := range events {
+		// A single empty message would fail the whole batch it's sent in.
+		if event.Message == "" {
+			empty = true
+			continue
+		}
+		if event.Timestamp.IsZero() {
+			event.Timestamp = now()
+		}
+		if !validTimestamp(event.Timestamp) {
+			invalid = append(invalid, event)
+			continue
+		}
+
+		input = append(input, w.fit(&cloudwatchlogs.InputLogEvent{
+			Message:   aws.String(event.Message),
+			Timestamp: aws.Int64(timestamp(event.Timestamp)),
+		})...)
+	}
+
+	if err := w.enqueue(input); err != nil {
+		return err
+	}
+
+	if len(invalid) > 0 {
+		return &TimestampRangeError{Events: invalid}
+	}
+	if empty {
+		return ErrEmptyMessage
+	}
+
+	// Report events lost since the last call, now that these are buffered.
+	return w.takeErr()
+}
+
+// timestamp converts t to the number of milliseconds since the epoch.
+func timestamp(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// eventTime converts a number of milliseconds since the epoch to a time.
+func eventTime(timestamp int64) time.Time {
+	return time.Unix(0, timestamp*int64(time.Millisecond))
+}
+
+// validTimestamp returns true if CloudWatch Logs would accept an event with
+// timestamp t now.
+func validTimestamp(t time.Time) bool {
+	n := now()
+	return !t.Before(n.Add(-maximumEventAge)) && !t.After(n.Add(maximumEventFuture))
+}
+
+// prepare sorts events chronologically, as CloudWatch Logs requires, and
+// removes any that it would reject because of their timestamp.
+func prepare(events []*cloudwatchlogs.InputLogEvent) (valid []*cloudwatchlogs.InputLogEvent, invalid *TimestampRangeError) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return *events[i].Timestamp < *events[j].Timestamp
+	})
+
+	valid = events[:0:0]
+	for _, event := range events {
+		t := eventTime(*event.Timestamp)
+		if validTimestamp(t) {
+			valid = append(valid, event)
+			continue
+		}
+
+		if invalid == nil {
+			invalid = &TimestampRangeError{}
+		}
+		invalid.Events = append(invalid.Events, Event{Timestamp: t, Message: *event.Message})
+	}
+	return valid, invalid
+}
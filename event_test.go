@@ -0,0 +1,96 @@
+package cloudwatch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/eltorocorp/cloudwatch/cloudwatchtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter_WriteEvents(t *testing.T) {
+	c := new(mockClient)
+	w := &Writer{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: c,
+		core:   newStreamCore(),
+	}
+
+	c.On("PutLogEvents", &cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("first"), Timestamp: aws.Int64(500)},
+			{Message: aws.String("second"), Timestamp: aws.Int64(1000)},
+			{Message: aws.String("third"), Timestamp: aws.Int64(2000)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	}).Return(&cloudwatchlogs.PutLogEventsOutput{}, nil)
+
+	future := Event{Timestamp: time.Unix(1, 0).Add(3 * time.Hour), Message: "future"}
+	err := w.WriteEvents([]Event{
+		{Timestamp: time.Unix(2, 0), Message: "third"},
+		{Message: "second"},
+		future,
+		{Timestamp: time.Unix(0, 500*int64(time.Millisecond)), Message: "first"},
+	})
+	if assert.IsType(t, &TimestampRangeError{}, err) {
+		assert.Equal(t, []Event{future}, err.(*TimestampRangeError).Events)
+	}
+
+	err = w.Flush()
+	assert.NoError(t, err)
+
+	c.AssertExpectations(t)
+}
+
+func TestWriter_WriteEventsEmpty(t *testing.T) {
+	f := cloudwatchtest.New()
+	f.Now = now
+
+	g, err := AttachGroup("group", f)
+	assert.NoError(t, err)
+	w, err := g.AttachStream("1234")
+	assert.NoError(t, err)
+
+	// An empty message is skipped, rather than failing the batch it would
+	// have been sent in.
+	err = w.WriteEvents([]Event{{Message: "before"}, {Message: ""}, {Message: "after"}})
+	assert.Equal(t, ErrEmptyMessage, err)
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, []string{"before", "after"}, f.Messages("group", "1234"))
+}
+
+func TestWriter_ExpiredWhileBuffered(t *testing.T) {
+	var dropped []*cloudwatchlogs.InputLogEvent
+
+	c := new(mockClient)
+	w := &Writer{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: c,
+		core:   newStreamCore(),
+		opts: WriterOptions{
+			OnDropped: func(events []*cloudwatchlogs.InputLogEvent, err error) {
+				assert.IsType(t, &TimestampRangeError{}, err)
+				dropped = append(dropped, events...)
+			},
+		},
+	}
+
+	assert.NoError(t, w.WriteEvent(Event{Message: "Hello"}))
+
+	defer func(n func() time.Time) { now = n }(now)
+	now = func() time.Time {
+		return time.Unix(1, 0).Add(maximumEventAge + time.Second)
+	}
+
+	err := w.Flush()
+	assert.IsType(t, &TimestampRangeError{}, err)
+	assert.Equal(t, []string{"Hello"}, messages(dropped))
+
+	c.AssertExpectations(t)
+}
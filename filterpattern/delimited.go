@@ -0,0 +1,141 @@
+package filterpattern
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// field is a field of a space delimited pattern.
+type field struct {
+	name string
+
+	// ellipsis matches any number of fields.
+	ellipsis bool
+
+	// cond, if set, must hold for the field's value.
+	cond cond
+}
+
+// compileDelimited compiles a pattern for space delimited log events, such as
+//
+//	[ip, user, username, timestamp, request, status_code = 4*, bytes > 1000]
+//
+// Each field matches a word of the message, or a phrase in quotes or square
+// brackets. A field of ... matches any number of words. The conditions on a
+// field can only refer to that field.
+func compileDelimited(pattern string) (func(string) bool, error) {
+	tokens, err := lex(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+
+	var fields []field
+	for !p.isPunct("]") {
+		if len(fields) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+
+		t := p.next()
+		if t.kind != tokenWord {
+			return nil, p.unexpected(t, "a field")
+		}
+		f := field{name: t.text, ellipsis: t.text == "..."}
+
+		if !f.ellipsis && !p.isPunct(",") && !p.isPunct("]") {
+			// The field's name is also the start of its condition.
+			p.pos--
+			n := len(p.selectors)
+			if f.cond, err = p.or(); err != nil {
+				return nil, err
+			}
+			for _, selector := range p.selectors[n:] {
+				if selector != f.name {
+					return nil, fmt.Errorf("filterpattern: condition on field %s refers to %s", f.name, selector)
+				}
+			}
+		}
+		fields = append(fields, f)
+	}
+	p.next()
+	if t := p.next(); t.kind != tokenEOF {
+		return nil, p.unexpected(t, "end of pattern")
+	}
+
+	return func(message string) bool {
+		return matchFields(fields, splitFields(message))
+	}, nil
+}
+
+// matchFields reports whether the words of a message match fields.
+func matchFields(fields []field, words []string) bool {
+	if len(fields) == 0 {
+		return len(words) == 0
+	}
+
+	f := fields[0]
+	if f.ellipsis {
+		for i := 0; i <= len(words); i++ {
+			if matchFields(fields[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(words) == 0 {
+		return false
+	}
+	if f.cond != nil {
+		word := words[0]
+		ok := f.cond(func(name string) (interface{}, bool) {
+			return word, name == f.name
+		})
+		if !ok {
+			return false
+		}
+	}
+	return matchFields(fields[1:], words[1:])
+}
+
+// splitFields splits a message into words, keeping phrases in quotes or
+// square brackets together, without them.
+func splitFields(message string) []string {
+	var words []string
+	for i := 0; i < len(message); {
+		if unicode.IsSpace(rune(message[i])) {
+			i++
+			continue
+		}
+
+		var end byte
+		switch message[i] {
+		case '"':
+			end = '"'
+		case '[':
+			end = ']'
+		}
+		if end != 0 {
+			if j := strings.IndexByte(message[i+1:], end); j >= 0 {
+				words = append(words, message[i+1:i+1+j])
+				i += j + 2
+				continue
+			}
+		}
+
+		j := strings.IndexFunc(message[i:], unicode.IsSpace)
+		if j < 0 {
+			j = len(message) - i
+		}
+		words = append(words, message[i:i+j])
+		i += j
+	}
+	return words
+}
@@ -0,0 +1,359 @@
+package filterpattern
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The conditions in JSON and space delimited patterns share a syntax:
+//
+//	selector op value            op is =, !=, <, <=, > or >=
+//	selector IS NULL             also IS TRUE and IS FALSE
+//	selector NOT EXISTS
+//	cond && cond, cond || cond, (cond)
+//
+// A value is a number or a string, which may be quoted, and in which *
+// matches any sequence of characters.
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// puncts are the punctuation tokens, longest first.
+var puncts = []string{"&&", "||", "!=", "<=", ">=", "=", "<", ">", "(", ")", "{", "}", "[", "]", ","}
+
+// lex splits a JSON or space delimited pattern into tokens.
+func lex(pattern string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(pattern); {
+		c := pattern[i]
+		if unicode.IsSpace(rune(c)) {
+			i++
+			continue
+		}
+
+		if c == '"' {
+			s, n, err := lexString(pattern[i:])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokenString, s})
+			i += n
+			continue
+		}
+
+		if p := punctAt(pattern[i:]); p != "" {
+			tokens = append(tokens, token{tokenPunct, p})
+			i += len(p)
+			continue
+		}
+
+		// JSON selectors can contain brackets, as in $.items[0].
+		selector := c == '$'
+		j := i
+		for j < len(pattern) {
+			c := pattern[j]
+			if unicode.IsSpace(rune(c)) || c == '"' || c == '!' {
+				break
+			}
+			if punctAt(pattern[j:]) != "" && !(selector && (c == '[' || c == ']')) {
+				break
+			}
+			j++
+		}
+		if j == i {
+			return nil, fmt.Errorf("filterpattern: unexpected %q", c)
+		}
+		tokens = append(tokens, token{tokenWord, pattern[i:j]})
+		i = j
+	}
+	return append(tokens, token{kind: tokenEOF}), nil
+}
+
+func punctAt(s string) string {
+	for _, p := range puncts {
+		if strings.HasPrefix(s, p) {
+			return p
+		}
+	}
+	return ""
+}
+
+// lexString reads the quoted string at the start of s, returning it without
+// its quotes and the number of bytes read.
+func lexString(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			if i+1 < len(s) {
+				i++
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return "", 0, errUnterminatedQuote
+}
+
+// lookup returns the value of a selector, and whether it exists. Values are
+// strings, json.Numbers, bools, nil, or JSON objects and arrays.
+type lookup func(selector string) (interface{}, bool)
+
+// cond is a compiled condition.
+type cond func(lookup) bool
+
+type parser struct {
+	tokens []token
+	pos    int
+
+	// selectors are the selectors in the conditions parsed.
+	selectors []string
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isPunct(text string) bool {
+	t := p.peek()
+	return t.kind == tokenPunct && t.text == text
+}
+
+func (p *parser) expect(text string) error {
+	if t := p.next(); t.kind != tokenPunct || t.text != text {
+		return p.unexpected(t, text)
+	}
+	return nil
+}
+
+func (p *parser) unexpected(t token, want string) error {
+	if t.kind == tokenEOF {
+		return fmt.Errorf("filterpattern: expected %s at end of pattern", want)
+	}
+	return fmt.Errorf("filterpattern: expected %s, got %q", want, t.text)
+}
+
+// or parses conditions joined by ||.
+func (p *parser) or() (cond, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.isPunct("||") {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(get lookup) bool { return l(get) || right(get) }
+	}
+	return left, nil
+}
+
+// and parses conditions joined by &&.
+func (p *parser) and() (cond, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.isPunct("&&") {
+		p.next()
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(get lookup) bool { return l(get) && right(get) }
+	}
+	return left, nil
+}
+
+// term parses a parenthesized condition or a comparison.
+func (p *parser) term() (cond, error) {
+	if p.isPunct("(") {
+		p.next()
+		c, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return c, p.expect(")")
+	}
+
+	t := p.next()
+	if t.kind != tokenWord {
+		return nil, p.unexpected(t, "a field")
+	}
+	selector := t.text
+	p.selectors = append(p.selectors, selector)
+
+	if t := p.peek(); t.kind == tokenWord {
+		p.next()
+		switch t.text {
+		case "IS":
+			return p.is(selector)
+		case "NOT":
+			if t := p.next(); t.kind != tokenWord || t.text != "EXISTS" {
+				return nil, p.unexpected(t, "EXISTS")
+			}
+			return func(get lookup) bool {
+				_, ok := get(selector)
+				return !ok
+			}, nil
+		}
+		return nil, p.unexpected(t, "an operator")
+	}
+
+	op := p.next()
+	switch op.text {
+	case "=", "!=", "<", "<=", ">", ">=":
+	default:
+		return nil, p.unexpected(op, "an operator")
+	}
+
+	t = p.next()
+	if t.kind != tokenWord && t.kind != tokenString {
+		return nil, p.unexpected(t, "a value")
+	}
+	v := newValue(t)
+
+	return func(get lookup) bool {
+		x, ok := get(selector)
+		if !ok {
+			return false
+		}
+		return compare(x, op.text, v)
+	}, nil
+}
+
+// is parses the rest of an IS condition.
+func (p *parser) is(selector string) (cond, error) {
+	t := p.next()
+	var want interface{}
+	switch t.text {
+	case "NULL":
+		want = nil
+	case "TRUE":
+		want = true
+	case "FALSE":
+		want = false
+	default:
+		return nil, p.unexpected(t, "NULL, TRUE or FALSE")
+	}
+	return func(get lookup) bool {
+		x, ok := get(selector)
+		return ok && x == want
+	}, nil
+}
+
+// value is a value that fields are compared to.
+type value struct {
+	text    string
+	number  float64
+	numeric bool
+}
+
+func newValue(t token) value {
+	v := value{text: t.text}
+	if t.kind == tokenWord {
+		if n, err := strconv.ParseFloat(t.text, 64); err == nil {
+			v.number, v.numeric = n, true
+		}
+	}
+	return v
+}
+
+// compare reports whether x op v. Numbers are compared numerically, and
+// everything else as text, with * in v matching any sequence of characters.
+func compare(x interface{}, op string, v value) bool {
+	var text string
+	var number float64
+	var numeric bool
+	switch x := x.(type) {
+	case string:
+		text = x
+		if n, err := strconv.ParseFloat(x, 64); err == nil {
+			number, numeric = n, true
+		}
+	case json.Number:
+		text = x.String()
+		if n, err := x.Float64(); err == nil {
+			number, numeric = n, true
+		}
+	case bool:
+		text = strconv.FormatBool(x)
+	default:
+		// Null, objects and arrays can only be matched with IS and EXISTS.
+		return false
+	}
+
+	switch op {
+	case "=", "!=":
+		equal := glob(v.text, text)
+		if v.numeric && numeric {
+			equal = number == v.number
+		}
+		return equal == (op == "=")
+	}
+
+	if !v.numeric || !numeric {
+		return false
+	}
+	switch op {
+	case "<":
+		return number < v.number
+	case "<=":
+		return number <= v.number
+	case ">":
+		return number > v.number
+	default:
+		return number >= v.number
+	}
+}
+
+// glob reports whether s matches pattern, in which * matches any sequence of
+// characters.
+func glob(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return len(s) >= len(last) && strings.HasSuffix(s, last)
+}
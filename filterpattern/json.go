@@ -0,0 +1,131 @@
+package filterpattern
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// compileJSON compiles a pattern for JSON log events, such as
+//
+//	{ ($.level = "error" || $.level = "warn") && $.latency > 100 }
+//
+// Selectors start with $ and can select object keys and array elements, as in
+// $.request.headers[0]. Messages that aren't JSON objects don't match.
+func compileJSON(pattern string) (func(string) bool, error) {
+	tokens, err := lex(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	c, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	if t := p.next(); t.kind != tokenEOF {
+		return nil, p.unexpected(t, "end of pattern")
+	}
+
+	// Check the selectors now, rather than failing to match every message.
+	paths := make(map[string][]interface{})
+	for _, selector := range p.selectors {
+		path, err := parseSelector(selector)
+		if err != nil {
+			return nil, err
+		}
+		paths[selector] = path
+	}
+
+	return func(message string) bool {
+		d := json.NewDecoder(strings.NewReader(message))
+		d.UseNumber()
+
+		var doc map[string]interface{}
+		if err := d.Decode(&doc); err != nil {
+			return false
+		}
+
+		return c(func(selector string) (interface{}, bool) {
+			path, ok := paths[selector]
+			if !ok {
+				return nil, false
+			}
+			return resolve(doc, path)
+		})
+	}, nil
+}
+
+// parseSelector parses a selector into the object keys (strings) and array
+// indexes (ints) that it selects.
+func parseSelector(selector string) ([]interface{}, error) {
+	invalid := fmt.Errorf("filterpattern: invalid selector %q", selector)
+	if !strings.HasPrefix(selector, "$") {
+		return nil, invalid
+	}
+
+	var path []interface{}
+	s := selector[1:]
+	for s != "" {
+		switch s[0] {
+		case '.':
+			end := strings.IndexAny(s[1:], ".[")
+			if end < 0 {
+				end = len(s) - 1
+			}
+			key := s[1 : end+1]
+			if key == "" {
+				return nil, invalid
+			}
+			path = append(path, key)
+			s = s[end+1:]
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, invalid
+			}
+			i, err := strconv.Atoi(s[1:end])
+			if err != nil || i < 0 {
+				return nil, invalid
+			}
+			path = append(path, i)
+			s = s[end+1:]
+		default:
+			return nil, invalid
+		}
+	}
+	if len(path) == 0 {
+		return nil, invalid
+	}
+	return path, nil
+}
+
+// resolve returns the value at path in doc, and whether it exists.
+func resolve(doc interface{}, path []interface{}) (interface{}, bool) {
+	for _, step := range path {
+		switch step := step.(type) {
+		case string:
+			obj, ok := doc.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if doc, ok = obj[step]; !ok {
+				return nil, false
+			}
+		case int:
+			arr, ok := doc.([]interface{})
+			if !ok || step >= len(arr) {
+				return nil, false
+			}
+			doc = arr[step]
+		}
+	}
+	return doc, true
+}
@@ -0,0 +1,144 @@
+// Package filterpattern evaluates CloudWatch Logs filter patterns locally, so
+// that test backends can filter events the way CloudWatch Logs does. It
+// supports the three kinds of pattern:
+//
+//	ERROR -Retrying                             terms
+//	{ $.level = "error" && $.latency > 100 }    JSON
+//	[ip, user, ..., status = 5*, bytes > 1000]  space delimited
+//
+// See
+// https://docs.aws.amazon.com/AmazonCloudWatch/latest/logs/FilterAndPatternSyntax.html
+package filterpattern
+
+import (
+	"errors"
+	"strings"
+)
+
+var errUnterminatedQuote = errors.New("filterpattern: unterminated quote")
+
+// Pattern is a compiled filter pattern.
+type Pattern struct {
+	match func(message string) bool
+}
+
+// Compile parses a filter pattern. An empty pattern matches every message.
+func Compile(pattern string) (*Pattern, error) {
+	pattern = strings.TrimSpace(pattern)
+
+	var match func(string) bool
+	var err error
+	switch {
+	case pattern == "" || pattern == `""`:
+		match = func(string) bool { return true }
+	case strings.HasPrefix(pattern, "{"):
+		match, err = compileJSON(pattern)
+	case strings.HasPrefix(pattern, "["):
+		match, err = compileDelimited(pattern)
+	default:
+		match, err = compileTerms(pattern)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Pattern{match: match}, nil
+}
+
+// MustCompile is like Compile, but panics if the pattern is invalid.
+func MustCompile(pattern string) *Pattern {
+	p, err := Compile(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Match reports whether message matches the pattern.
+func (p *Pattern) Match(message string) bool {
+	return p.match(message)
+}
+
+// compileTerms compiles a pattern for unstructured log events:
+//
+//	ERROR                  contains ERROR
+//	ERROR Exception        contains both ERROR and Exception
+//	?ERROR ?WARN           contains ERROR or WARN
+//	ERROR -Retrying        contains ERROR but not Retrying
+//	"connection refused"   contains the phrase
+//
+// Terms are case sensitive.
+func compileTerms(pattern string) (func(string) bool, error) {
+	terms, err := splitTerms(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var required, excluded, optional []string
+	for _, term := range terms {
+		switch {
+		case strings.HasPrefix(term, "-") && len(term) > 1:
+			excluded = append(excluded, unquote(term[1:]))
+		case strings.HasPrefix(term, "?") && len(term) > 1:
+			optional = append(optional, unquote(term[1:]))
+		default:
+			required = append(required, unquote(term))
+		}
+	}
+
+	return func(message string) bool {
+		for _, term := range required {
+			if !strings.Contains(message, term) {
+				return false
+			}
+		}
+		for _, term := range excluded {
+			if strings.Contains(message, term) {
+				return false
+			}
+		}
+		if len(optional) == 0 {
+			return true
+		}
+		for _, term := range optional {
+			if strings.Contains(message, term) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// splitTerms splits a pattern on spaces, keeping quoted phrases together.
+func splitTerms(pattern string) ([]string, error) {
+	var terms []string
+	var term strings.Builder
+	quoted := false
+	for _, r := range pattern {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			term.WriteRune(r)
+		case r == ' ' && !quoted:
+			if term.Len() > 0 {
+				terms = append(terms, term.String())
+				term.Reset()
+			}
+		default:
+			term.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, errUnterminatedQuote
+	}
+	if term.Len() > 0 {
+		terms = append(terms, term.String())
+	}
+	return terms, nil
+}
+
+func unquote(term string) string {
+	if len(term) >= 2 && strings.HasPrefix(term, `"`) && strings.HasSuffix(term, `"`) {
+		return term[1 : len(term)-1]
+	}
+	return term
+}
@@ -0,0 +1,97 @@
+package filterpattern
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		pattern string
+		message string
+		match   bool
+	}{
+		// Terms.
+		{"", "anything", true},
+		{"ERROR", "an ERROR occurred", true},
+		{"ERROR", "an error occurred", false},
+		{"ERROR Exception", "ERROR: NullPointerException", true},
+		{"ERROR Exception", "ERROR: timeout", false},
+		{"?ERROR ?WARN", "WARN: disk", true},
+		{"?ERROR ?WARN", "INFO: disk", false},
+		{"ERROR -Retrying", "ERROR: Retrying", false},
+		{`"connection refused"`, "dial: connection refused", true},
+		{`"connection refused"`, "refused connection", false},
+
+		// JSON.
+		{`{ $.level = "error" }`, `{"level": "error"}`, true},
+		{`{ $.level = "error" }`, `{"level": "info"}`, false},
+		{`{ $.level = "error" }`, `level=error`, false},
+		{`{ $.level = err* }`, `{"level": "error"}`, true},
+		{`{ $.level != "error" }`, `{"level": "info"}`, true},
+		{`{ $.level != "error" }`, `{}`, false},
+		{`{ $.latency > 100 }`, `{"latency": 150}`, true},
+		{`{ $.latency > 100 }`, `{"latency": 50}`, false},
+		{`{ $.latency >= 1e2 }`, `{"latency": 100}`, true},
+		{`{ $.latency > 100 }`, `{"latency": "slow"}`, false},
+		{`{ $.status = 200 }`, `{"status": 200.0}`, true},
+		{`{ $.user.name = "bob" }`, `{"user": {"name": "bob"}}`, true},
+		{`{ $.items[1] = "b" }`, `{"items": ["a", "b"]}`, true},
+		{`{ $.items[2] = "b" }`, `{"items": ["a", "b"]}`, false},
+		{`{ $.level = "error" && $.latency > 100 }`, `{"level": "error", "latency": 50}`, false},
+		{`{ $.level = "error" || $.latency > 100 }`, `{"level": "info", "latency": 150}`, true},
+		{`{ ($.a = 1 || $.b = 1) && $.c = 1 }`, `{"b": 1, "c": 1}`, true},
+		{`{ ($.a = 1 || $.b = 1) && $.c = 1 }`, `{"b": 1, "c": 2}`, false},
+		{`{ $.error IS NULL }`, `{"error": null}`, true},
+		{`{ $.error IS NULL }`, `{}`, false},
+		{`{ $.ok IS TRUE }`, `{"ok": true}`, true},
+		{`{ $.ok IS FALSE }`, `{"ok": true}`, false},
+		{`{ $.error NOT EXISTS }`, `{}`, true},
+		{`{ $.error NOT EXISTS }`, `{"error": null}`, false},
+		{`{ $.message = "say \"hi\"" }`, `{"message": "say \"hi\""}`, true},
+
+		// Space delimited.
+		{`[ip, user, username, timestamp, request, status_code, bytes]`,
+			`127.0.0.1 - frank [10/Oct/2000:13:25:15 -0700] "GET /apache_pb.gif HTTP/1.0" 200 1534`, true},
+		{`[ip, user, username, timestamp, request, status_code = 4*, bytes]`,
+			`127.0.0.1 - frank [10/Oct/2000:13:25:15 -0700] "GET /apache_pb.gif HTTP/1.0" 200 1534`, false},
+		{`[ip, user, username, timestamp, request = *.gif*, status_code = 2*, bytes > 1000]`,
+			`127.0.0.1 - frank [10/Oct/2000:13:25:15 -0700] "GET /apache_pb.gif HTTP/1.0" 200 1534`, true},
+		{`[..., status_code = 200, bytes]`,
+			`127.0.0.1 - frank [10/Oct/2000:13:25:15 -0700] "GET /apache_pb.gif HTTP/1.0" 200 1534`, true},
+		{`[ip, ..., bytes < 1000]`,
+			`127.0.0.1 - frank [10/Oct/2000:13:25:15 -0700] "GET /apache_pb.gif HTTP/1.0" 200 1534`, false},
+		{`[level = ERROR || level = WARN, ...]`, `WARN disk full`, true},
+		{`[level = ERROR || level = WARN, ...]`, `INFO disk full`, false},
+		{`[a, b]`, `one`, false},
+		{`[a, b]`, `one two three`, false},
+	}
+
+	for _, tt := range tests {
+		p, err := Compile(tt.pattern)
+		if assert.NoError(t, err, tt.pattern) {
+			assert.Equal(t, tt.match, p.Match(tt.message), "%q %q", tt.pattern, tt.message)
+		}
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	for _, pattern := range []string{
+		`"unterminated`,
+		`{ $.level = "error }`,
+		`{ $.level = }`,
+		`{ $.level "error" }`,
+		`{ $.level = error`,
+		`{ $.level = error } extra`,
+		`{ level = error }`,
+		`{ $.items[x] = 1 }`,
+		`{ $.level IS MISSING }`,
+		`{ $.level ! error }`,
+		`[a, b = 1 && a = 2]`,
+		`[a b]`,
+	} {
+		_, err := Compile(pattern)
+		assert.Error(t, err, pattern)
+	}
+}
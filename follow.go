@@ -0,0 +1,372 @@
+package cloudwatch
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/eltorocorp/cloudwatch/filterpattern"
+)
+
+const (
+	defaultDiscoverEvery     = 10 * time.Second
+	defaultStreamIdleTimeout = 10 * time.Minute
+)
+
+// FollowOptions configures a Reader that follows the streams of a group,
+// including streams that are created after it starts.
+type FollowOptions struct {
+	// ReaderOptions configures how each stream is read. Follow is implied.
+	// StartFromHead and StartTime apply to the streams that exist when the
+	// Reader starts: streams that are created later are read from their
+	// first event.
+	//
+	// FilterPattern is evaluated locally, with the filterpattern package, as
+	// GetLogEvents can't filter. Every event in the followed streams is still
+	// fetched, so a selective pattern doesn't reduce the requests made or the
+	// data transferred.
+	ReaderOptions
+
+	// StreamPrefix and StreamRegexp limit the Reader to the streams whose
+	// names match them. If neither is set, every stream is followed.
+	StreamPrefix string
+	StreamRegexp *regexp.Regexp
+
+	// DiscoverEvery is how often the group is checked for new streams.
+	// Defaults to 10 seconds.
+	DiscoverEvery time.Duration
+
+	// IdleTimeout is how long a stream is followed for without any new
+	// events. Idle streams are followed again when they get new events.
+	// Defaults to 10 minutes.
+	IdleTimeout time.Duration
+
+	// Label prefixes each message returned by Read with the name of its
+	// stream, as "[stream] message". Events returned by Next always have
+	// their Stream set.
+	Label bool
+}
+
+// followState is the state of a Reader that follows the streams of a group.
+type followState struct {
+	prefix        string
+	regexp        *regexp.Regexp
+	filter        *filterpattern.Pattern
+	discoverEvery time.Duration
+	idleTimeout   time.Duration
+
+	// discovered is when the group was last checked for new streams.
+	discovered time.Time
+
+	// streams are the streams that have been followed, by name, and polling
+	// are those that are still being followed, which are read from in turn.
+	streams map[string]*followedStream
+	polling []*followedStream
+	next    int
+}
+
+// followedStream is the position of a Reader in one of the streams it
+// follows.
+type followedStream struct {
+	name          string
+	nextToken     *string
+	startTime     time.Time
+	startFromHead bool
+
+	// lastEvent is the timestamp of the last event read, and active is when
+	// the stream was last found to have new events.
+	lastEvent time.Time
+	active    time.Time
+
+	polling bool
+}
+
+func newFollower(group string, client Client, opts FollowOptions) (*Reader, error) {
+	if opts.Checkpointer != nil {
+		return nil, errCheckpointUnsupported
+	}
+
+	f, err := newFollowState(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Follow = true
+	return startReader(&Reader{
+		group:  aws.String(group),
+		client: client,
+		opts:   opts.ReaderOptions,
+		follow: f,
+		label:  opts.Label,
+	}), nil
+}
+
+func newFollowState(opts FollowOptions) (*followState, error) {
+	f := &followState{
+		prefix:        opts.StreamPrefix,
+		regexp:        opts.StreamRegexp,
+		discoverEvery: opts.DiscoverEvery,
+		idleTimeout:   opts.IdleTimeout,
+		streams:       make(map[string]*followedStream),
+	}
+	if opts.FilterPattern != "" {
+		filter, err := filterpattern.Compile(opts.FilterPattern)
+		if err != nil {
+			return nil, err
+		}
+		f.filter = filter
+	}
+	if f.discoverEvery == 0 {
+		f.discoverEvery = defaultDiscoverEvery
+	}
+	if f.idleTimeout == 0 {
+		f.idleTimeout = defaultStreamIdleTimeout
+	}
+	return f, nil
+}
+
+// readFollow checks the group for new streams, if it's time to, or otherwise
+// reads the next page of events from one of the streams being followed.
+// Streams are read in turn, one request at a time, so that the Reader stays
+// within the GetLogEvents rate limit however many streams there are.
+func (r *Reader) readFollow(ctx context.Context) error {
+	f := r.follow
+
+	wait := f.discoverEvery - now().Sub(f.discovered)
+	if f.discovered.IsZero() || wait <= 0 {
+		return r.discover(ctx)
+	}
+
+	// With no streams to read, there's nothing to do until the next check.
+	if len(f.polling) == 0 {
+		return sleep(ctx, wait)
+	}
+	f.next %= len(f.polling)
+	s := f.polling[f.next]
+	f.next++
+
+	return r.readFollowed(ctx, s)
+}
+
+// discover starts following the streams that have had events since the idle
+// timeout, and stops following the streams that have been idle for longer.
+func (r *Reader) discover(ctx context.Context) error {
+	f := r.follow
+
+	first := f.discovered.IsZero()
+	f.discovered = now()
+	cutoff := f.discovered.Add(-f.idleTimeout)
+
+	// Every stream is checked, rather than stopping at the first idle one
+	// in LastEventTime order, as CloudWatch Logs only updates LastEventTime
+	// eventually, and streams without events don't have one at all.
+	params := &cloudwatchlogs.DescribeLogStreamsInput{
+		LogGroupName: r.group,
+	}
+	if f.prefix != "" {
+		params.LogStreamNamePrefix = aws.String(f.prefix)
+	}
+	for {
+		var resp *cloudwatchlogs.DescribeLogStreamsOutput
+		err := r.limit(ctx, "DescribeLogStreams", func() (err error) {
+			resp, err = r.client.DescribeLogStreamsWithContext(ctx, params)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, stream := range resp.LogStreams {
+			last := lastActive(stream)
+			if last.Before(cutoff) || !f.matches(aws.StringValue(stream.LogStreamName)) {
+				continue
+			}
+			r.watch(aws.StringValue(stream.LogStreamName), last, first)
+		}
+
+		if resp.NextToken == nil {
+			break
+		}
+		params.NextToken = resp.NextToken
+	}
+
+	r.expire(cutoff)
+	return nil
+}
+
+// lastActive returns the latest of when a stream was created, and when it
+// last had an event, by timestamp or ingestion.
+func lastActive(stream *cloudwatchlogs.LogStream) time.Time {
+	last := eventTime(aws.Int64Value(stream.CreationTime))
+	for _, t := range []*int64{stream.LastEventTimestamp, stream.LastIngestionTime} {
+		if t != nil && eventTime(*t).After(last) {
+			last = eventTime(*t)
+		}
+	}
+	return last
+}
+
+func (f *followState) matches(stream string) bool {
+	if !strings.HasPrefix(stream, f.prefix) {
+		return false
+	}
+	return f.regexp == nil || f.regexp.MatchString(stream)
+}
+
+// watch starts following a stream, if it isn't being followed already. last
+// is when it last had an event, or was created.
+func (r *Reader) watch(name string, last time.Time, first bool) {
+	f := r.follow
+
+	s, ok := f.streams[name]
+	switch {
+	case !ok:
+		s = &followedStream{
+			name:          name,
+			startTime:     r.opts.StartTime,
+			startFromHead: true,
+		}
+		// Streams that already exist when the Reader starts are read as
+		// configured, and new streams from the start.
+		if first {
+			s.startFromHead = r.opts.StartFromHead
+		}
+		f.streams[name] = s
+	case s.polling || !last.After(s.lastEvent):
+		return
+	}
+
+	s.polling = true
+	s.active = now()
+	f.polling = append(f.polling, s)
+}
+
+// expire stops following the streams that haven't had new events since
+// cutoff. If one of them gets new events, it is read from after the last
+// event that was read, as its token may have expired by then.
+func (r *Reader) expire(cutoff time.Time) {
+	f := r.follow
+
+	polling := f.polling[:0]
+	for _, s := range f.polling {
+		if !s.active.Before(cutoff) {
+			polling = append(polling, s)
+			continue
+		}
+
+		s.polling = false
+		s.rewind()
+	}
+	f.polling = polling
+}
+
+// rewind drops a stream's token, so that it's next read from after the last
+// event that was read.
+func (s *followedStream) rewind() {
+	s.nextToken = nil
+	if !s.lastEvent.IsZero() {
+		s.startTime = s.lastEvent.Add(time.Millisecond)
+		s.startFromHead = true
+	}
+}
+
+// drop stops following a stream until it gets new events.
+func (f *followState) drop(s *followedStream) {
+	s.polling = false
+	for i, p := range f.polling {
+		if p == s {
+			f.polling = append(f.polling[:i], f.polling[i+1:]...)
+			break
+		}
+	}
+}
+
+// remove forgets a stream that has been deleted.
+func (f *followState) remove(s *followedStream) {
+	f.drop(s)
+	delete(f.streams, s.name)
+}
+
+// readFollowed reads the next page of events from a stream being followed.
+func (r *Reader) readFollowed(ctx context.Context, s *followedStream) error {
+	params := &cloudwatchlogs.GetLogEventsInput{
+		LogGroupName:  r.group,
+		LogStreamName: aws.String(s.name),
+		NextToken:     s.nextToken,
+		// CloudWatch Logs requires StartFromHead with a forward token.
+		StartFromHead: aws.Bool(s.startFromHead || s.nextToken != nil),
+	}
+	if !s.startTime.IsZero() {
+		params.StartTime = aws.Int64(timestamp(s.startTime))
+	}
+	if !r.opts.EndTime.IsZero() {
+		params.EndTime = aws.Int64(timestamp(r.opts.EndTime))
+	}
+
+	var resp *cloudwatchlogs.GetLogEventsOutput
+	err := r.limit(ctx, "GetLogEvents", func() (err error) {
+		resp, err = r.client.GetLogEventsWithContext(ctx, params)
+		return err
+	})
+	if err != nil {
+		return r.followFailed(ctx, s, err)
+	}
+
+	if resp.NextForwardToken != nil {
+		s.nextToken = resp.NextForwardToken
+	}
+
+	var events []Event
+	for _, event := range resp.Events {
+		e := Event{
+			Timestamp: eventTime(aws.Int64Value(event.Timestamp)),
+			Message:   aws.StringValue(event.Message),
+			Stream:    s.name,
+		}
+		if event.IngestionTime != nil {
+			e.IngestionTime = eventTime(*event.IngestionTime)
+		}
+		s.lastEvent = e.Timestamp
+		s.active = now()
+
+		if r.follow.filter == nil || r.follow.filter.Match(e.Message) {
+			events = append(events, e)
+		}
+	}
+	r.add(events, nil)
+	return nil
+}
+
+// followFailed handles an error reading a stream being followed. Errors that
+// concern only the stream, such as its token having expired, don't stop the
+// other streams being followed: the stream is read again from after the last
+// event read, and if that fails too, it isn't followed until it gets new
+// events.
+func (r *Reader) followFailed(ctx context.Context, s *followedStream, err error) error {
+	if ctx.Err() != nil {
+		return err
+	}
+
+	awsErr, ok := err.(awserr.Error)
+	switch {
+	case ok && awsErr.Code() == throttlingCode:
+		return err
+	case ok && awsErr.Code() == cloudwatchlogs.ErrCodeResourceNotFoundException:
+		// The stream has been deleted, so stop following it. If it is
+		// created again, it is read from the start.
+		r.follow.remove(s)
+		return nil
+	}
+
+	FallbackLogger.Errorln("error following stream", *r.group, s.name, err)
+	if s.nextToken != nil {
+		s.rewind()
+	} else {
+		r.follow.drop(s)
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package cloudwatch
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/eltorocorp/cloudwatch/cloudwatchtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReader_Follow(t *testing.T) {
+	clock := time.Unix(1000, 0)
+	defer func(n func() time.Time) { now = n }(now)
+	now = func() time.Time { return clock }
+
+	f := cloudwatchtest.New()
+	f.Now = now
+
+	g, err := AttachGroup("group", f)
+	assert.NoError(t, err)
+
+	tokens := make(map[string]*string)
+	put := func(stream, message string) {
+		resp, err := f.PutLogEvents(&cloudwatchlogs.PutLogEventsInput{
+			LogGroupName:  aws.String("group"),
+			LogStreamName: aws.String(stream),
+			SequenceToken: tokens[stream],
+			LogEvents: []*cloudwatchlogs.InputLogEvent{
+				{Timestamp: aws.Int64(timestamp(clock)), Message: aws.String(message)},
+			},
+		})
+		assert.NoError(t, err)
+		tokens[stream] = resp.NextSequenceToken
+	}
+	// The Writers are only used to create the streams, so they're closed
+	// straight away rather than left flushing while the clock changes.
+	attach := func(stream string) {
+		w, err := g.AttachStream(stream)
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+	}
+
+	follow, err := newFollowState(FollowOptions{
+		StreamPrefix:  "agent-",
+		StreamRegexp:  regexp.MustCompile(`-\d+$`),
+		DiscoverEvery: 10 * time.Second,
+		IdleTimeout:   time.Minute,
+	})
+	assert.NoError(t, err)
+	r := &Reader{
+		group:  aws.String("group"),
+		client: f,
+		opts:   ReaderOptions{StartFromHead: true, Follow: true, Limiter: NewLimiter(nil)},
+		follow: follow,
+		label:  true,
+	}
+	read := func(n int) {
+		for i := 0; i < n; i++ {
+			assert.NoError(t, r.read(context.Background()))
+		}
+	}
+	next := func() []string {
+		var events []string
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+			event, err := r.Next(ctx)
+			cancel()
+			if err != nil {
+				return events
+			}
+			events = append(events, event.Stream+": "+event.Message)
+		}
+	}
+
+	attach("agent-1")
+	attach("web-1")
+	put("agent-1", "one")
+	put("web-1", "web")
+
+	// The first read discovers the streams, and the next reads from them.
+	read(2)
+	b := make([]byte, 100)
+	n, err := r.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, "[agent-1] one", string(b[:n]))
+
+	// New streams are found on the next discovery.
+	attach("agent-2")
+	attach("agent-x")
+	put("agent-2", "two")
+	put("agent-x", "x")
+	read(1)
+	assert.Empty(t, next())
+
+	clock = clock.Add(10 * time.Second)
+	read(3)
+	assert.Equal(t, []string{"agent-2: two"}, next())
+
+	// Streams without new events are stopped after the idle timeout.
+	clock = clock.Add(2 * time.Minute)
+	read(1)
+	assert.Empty(t, r.follow.polling)
+
+	// An idle stream is followed again when it has new events, from after
+	// the last event read.
+	put("agent-1", "three")
+	clock = clock.Add(10 * time.Second)
+	read(2)
+	assert.Equal(t, []string{"agent-1: three"}, next())
+
+	// Deleted streams are forgotten.
+	_, err = f.DeleteLogStream(&cloudwatchlogs.DeleteLogStreamInput{
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("agent-1"),
+	})
+	assert.NoError(t, err)
+	read(1)
+	assert.Empty(t, r.follow.polling)
+	assert.NotContains(t, r.follow.streams, "agent-1")
+}
+
+func TestGroup_Follow(t *testing.T) {
+	f := cloudwatchtest.New()
+	f.Now = now
+
+	g, err := AttachGroup("group", f)
+	assert.NoError(t, err)
+	w, err := g.AttachStream("agent-1")
+	assert.NoError(t, err)
+
+	w.Write([]byte("ERROR one\nINFO two\n"))
+	assert.NoError(t, w.Close())
+
+	r, err := g.Follow(FollowOptions{
+		ReaderOptions: ReaderOptions{StartFromHead: true, FilterPattern: "ERROR"},
+	})
+	assert.NoError(t, err)
+	defer r.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	event, err := r.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "agent-1", event.Stream)
+	assert.Equal(t, "ERROR one\n", event.Message)
+
+	_, err = g.Follow(FollowOptions{ReaderOptions: ReaderOptions{FilterPattern: "{"}})
+	assert.Error(t, err)
+}
+
+func TestReader_FollowTail(t *testing.T) {
+	f := cloudwatchtest.New()
+	f.Now = now
+
+	g, err := AttachGroup("group", f)
+	assert.NoError(t, err)
+	w, err := g.AttachStream("1234")
+	assert.NoError(t, err)
+	io.WriteString(w, "Hello\n")
+	assert.NoError(t, w.Flush())
+
+	follow, err := newFollowState(FollowOptions{})
+	assert.NoError(t, err)
+	r := &Reader{
+		group:  aws.String("group"),
+		client: f,
+		opts:   ReaderOptions{Follow: true, Limiter: NewLimiter(nil)},
+		follow: follow,
+	}
+
+	// Streams that exist at the start are tailed, and then followed with
+	// their forward tokens.
+	assert.NoError(t, r.read(context.Background()))
+	assert.NoError(t, r.read(context.Background()))
+	io.WriteString(w, "World\n")
+	assert.NoError(t, w.Close())
+	assert.NoError(t, r.read(context.Background()))
+
+	b := make([]byte, 100)
+	n, err := r.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello\nWorld\n", string(b[:n]))
+}
+
+func TestReader_FollowStreamError(t *testing.T) {
+	clock := time.Unix(1000, 0)
+	defer func(n func() time.Time) { now = n }(now)
+	now = func() time.Time { return clock }
+
+	f := cloudwatchtest.New()
+	f.Now = now
+
+	g, err := AttachGroup("group", f)
+	assert.NoError(t, err)
+	w, err := g.AttachStream("1234")
+	assert.NoError(t, err)
+	io.WriteString(w, "Hello\n")
+	assert.NoError(t, w.Flush())
+
+	follow, err := newFollowState(FollowOptions{})
+	assert.NoError(t, err)
+	r := &Reader{
+		group:  aws.String("group"),
+		client: f,
+		opts:   ReaderOptions{StartFromHead: true, Follow: true, Limiter: NewLimiter(nil)},
+		follow: follow,
+	}
+	assert.NoError(t, r.read(context.Background()))
+	assert.NoError(t, r.read(context.Background()))
+
+	// An error reading the stream doesn't stop the Reader, and the stream
+	// is read again from after the last event read.
+	invalid := awserr.New("InvalidParameterException", "The specified nextToken is invalid.", nil)
+	f.Fail("GetLogEvents", 1, invalid)
+	assert.NoError(t, r.read(context.Background()))
+	assert.Len(t, follow.polling, 1)
+
+	assert.NoError(t, w.WriteEvent(Event{Timestamp: clock.Add(time.Second), Message: "World\n"}))
+	assert.NoError(t, w.Close())
+	assert.NoError(t, r.read(context.Background()))
+
+	b := make([]byte, 100)
+	n, err := r.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello\nWorld\n", string(b[:n]))
+
+	// Throttling is left to the Limiter.
+	f.Throttle("GetLogEvents", 1)
+	assert.Error(t, r.read(context.Background()))
+	assert.Len(t, follow.polling, 1)
+
+	// If reading it again fails too, the stream is dropped until it gets
+	// new events.
+	f.Fail("GetLogEvents", 2, invalid)
+	assert.NoError(t, r.read(context.Background()))
+	assert.NoError(t, r.read(context.Background()))
+	assert.Empty(t, follow.polling)
+	assert.Contains(t, follow.streams, "1234")
+}
+
+func TestReader_FollowDiscover(t *testing.T) {
+	clock := time.Unix(1000, 0)
+	defer func(n func() time.Time) { now = n }(now)
+	now = func() time.Time { return clock }
+
+	f := cloudwatchtest.New()
+	f.Now = now
+
+	_, err := AttachGroup("group", f)
+	assert.NoError(t, err)
+	create := func(stream string) {
+		_, err := f.CreateLogStream(&cloudwatchlogs.CreateLogStreamInput{
+			LogGroupName:  aws.String("group"),
+			LogStreamName: aws.String(stream),
+		})
+		assert.NoError(t, err)
+	}
+
+	// A stream that has been idle for longer than the timeout, and a new
+	// stream without any events, whose LastEventTimestamp isn't set.
+	create("a-idle")
+	_, err = f.PutLogEvents(&cloudwatchlogs.PutLogEventsInput{
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("a-idle"),
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Timestamp: aws.Int64(timestamp(clock)), Message: aws.String("old")},
+		},
+	})
+	assert.NoError(t, err)
+	clock = clock.Add(time.Hour)
+	create("b-new")
+
+	follow, err := newFollowState(FollowOptions{})
+	assert.NoError(t, err)
+	r := &Reader{
+		group:  aws.String("group"),
+		client: f,
+		opts:   ReaderOptions{Follow: true, Limiter: NewLimiter(nil)},
+		follow: follow,
+	}
+	assert.NoError(t, r.read(context.Background()))
+
+	// The new stream is followed, even though it comes after the idle one.
+	assert.Contains(t, follow.streams, "b-new")
+	assert.NotContains(t, follow.streams, "a-idle")
+}
@@ -0,0 +1,190 @@
+package cloudwatch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// A Writer flushes every 5 seconds by default, so events are commonly
+// ingested several seconds after their timestamps. Polls for new events start
+// this far before the latest event read, so that they aren't missed.
+const defaultOverlap = 30 * time.Second
+
+var (
+	errStreamsAndPrefix      = errors.New("cloudwatch: only one of Streams and StreamPrefix can be set")
+	errCheckpointUnsupported = errors.New("cloudwatch: Checkpointer is only supported when reading a single stream without a FilterPattern")
+)
+
+// GroupReaderOptions configures a Reader for several streams in a group.
+type GroupReaderOptions struct {
+	ReaderOptions
+
+	// Streams limits the Reader to the named streams, of which there can be
+	// up to 100. StreamPrefix limits it to the streams whose names start with
+	// the prefix. Only one can be set. If neither is, every stream in the
+	// group is read.
+	Streams      []string
+	StreamPrefix string
+
+	// Overlap is how far before the latest event read each poll for new
+	// events starts, so that events ingested late are still read. Events are
+	// deduplicated by ID, so none are returned twice. Defaults to 30 seconds.
+	//
+	// The streams are merged in timestamp order only on a best-effort basis:
+	// each page of events is sorted, but an event ingested late is returned
+	// when it's found, after any later events already returned, and one
+	// ingested more than Overlap after the latest event read is missed.
+	Overlap time.Duration
+}
+
+// filterState is the state of a Reader that reads with FilterLogEvents,
+// because it reads several streams or has a FilterPattern.
+type filterState struct {
+	streams []*string
+	prefix  *string
+	pattern *string
+	overlap time.Duration
+
+	// start is the start time of the current poll, and nextToken pages
+	// through it.
+	start     time.Time
+	nextToken *string
+
+	// latest is the latest timestamp read, and seen holds the timestamps of
+	// the events read since latest-overlap, by ID.
+	latest time.Time
+	seen   map[string]time.Time
+}
+
+func newGroupReader(group string, client Client, opts GroupReaderOptions) (*Reader, error) {
+	if len(opts.Streams) > 0 && opts.StreamPrefix != "" {
+		return nil, errStreamsAndPrefix
+	}
+	if opts.Checkpointer != nil {
+		return nil, errCheckpointUnsupported
+	}
+
+	return startReader(&Reader{
+		group:  aws.String(group),
+		client: client,
+		opts:   opts.ReaderOptions,
+		filter: newFilterState(opts),
+	}), nil
+}
+
+func newFilterState(opts GroupReaderOptions) *filterState {
+	f := &filterState{
+		overlap: opts.Overlap,
+		seen:    make(map[string]time.Time),
+	}
+	if len(opts.Streams) > 0 {
+		f.streams = aws.StringSlice(opts.Streams)
+	}
+	if opts.StreamPrefix != "" {
+		f.prefix = aws.String(opts.StreamPrefix)
+	}
+	if opts.FilterPattern != "" {
+		f.pattern = aws.String(opts.FilterPattern)
+	}
+	if f.overlap == 0 {
+		f.overlap = defaultOverlap
+	}
+
+	// Like tail, start with the most recent events, unless a StartTime is
+	// given.
+	if !opts.StartFromHead && opts.StartTime.IsZero() {
+		f.latest = now()
+	}
+	return f
+}
+
+// readFilter reads the next page of events from the streams with
+// FilterLogEvents. Once the last page has been read, the next poll starts
+// again from shortly before the latest event, and skips the events that have
+// already been read. Events are sorted within each page, but not across
+// pages or polls.
+func (r *Reader) readFilter(ctx context.Context) error {
+	f := r.filter
+
+	if f.nextToken == nil {
+		f.start = r.opts.StartTime
+		if start := f.latest.Add(-f.overlap); !f.latest.IsZero() && start.After(f.start) {
+			f.start = start
+		}
+	}
+
+	params := &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:        r.group,
+		LogStreamNames:      f.streams,
+		LogStreamNamePrefix: f.prefix,
+		FilterPattern:       f.pattern,
+		NextToken:           f.nextToken,
+	}
+	if !f.start.IsZero() {
+		params.StartTime = aws.Int64(timestamp(f.start))
+	}
+	if !r.opts.EndTime.IsZero() {
+		// Unlike GetLogEvents, FilterLogEvents includes events at EndTime.
+		params.EndTime = aws.Int64(timestamp(r.opts.EndTime) - 1)
+	}
+
+	var resp *cloudwatchlogs.FilterLogEventsOutput
+	err := r.limit(ctx, "FilterLogEvents", func() (err error) {
+		resp, err = r.client.FilterLogEventsWithContext(ctx, params)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(resp.Events, func(i, j int) bool {
+		return aws.Int64Value(resp.Events[i].Timestamp) < aws.Int64Value(resp.Events[j].Timestamp)
+	})
+
+	var events []Event
+	for _, event := range resp.Events {
+		id := aws.StringValue(event.EventId)
+		if _, ok := f.seen[id]; ok {
+			continue
+		}
+
+		e := Event{
+			Timestamp: eventTime(aws.Int64Value(event.Timestamp)),
+			Message:   aws.StringValue(event.Message),
+			Stream:    aws.StringValue(event.LogStreamName),
+			ID:        id,
+		}
+		if event.IngestionTime != nil {
+			e.IngestionTime = eventTime(*event.IngestionTime)
+		}
+		events = append(events, e)
+
+		if r.opts.Follow {
+			f.seen[id] = e.Timestamp
+		}
+		if e.Timestamp.After(f.latest) {
+			f.latest = e.Timestamp
+		}
+	}
+	r.add(events, nil)
+
+	// Later polls start from latest-overlap, so they won't return the events
+	// before it again.
+	for id, t := range f.seen {
+		if t.Before(f.latest.Add(-f.overlap)) {
+			delete(f.seen, id)
+		}
+	}
+
+	f.nextToken = resp.NextToken
+	if f.nextToken == nil && !r.opts.Follow {
+		return io.EOF
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package cloudwatch
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/eltorocorp/cloudwatch/cloudwatchtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroup_OpenAll(t *testing.T) {
+	f := cloudwatchtest.New()
+	f.Now = now
+
+	g, err := AttachGroup("group", f)
+	assert.NoError(t, err)
+
+	tokens := make(map[string]*string)
+	put := func(stream string, ms int64, message string) {
+		resp, err := f.PutLogEvents(&cloudwatchlogs.PutLogEventsInput{
+			LogGroupName:  aws.String("group"),
+			LogStreamName: aws.String(stream),
+			SequenceToken: tokens[stream],
+			LogEvents: []*cloudwatchlogs.InputLogEvent{
+				{Timestamp: aws.Int64(ms), Message: aws.String(message)},
+			},
+		})
+		assert.NoError(t, err)
+		tokens[stream] = resp.NextSequenceToken
+	}
+	for _, stream := range []string{"agent-1", "agent-2", "other"} {
+		w, err := g.AttachStream(stream)
+		assert.NoError(t, err)
+		defer w.Close()
+	}
+	put("agent-2", 2000, "two")
+	put("agent-1", 1000, "one")
+	put("other", 1500, "other")
+	put("agent-1", 3000, "three")
+
+	r, err := g.OpenAll(GroupReaderOptions{
+		ReaderOptions: ReaderOptions{StartFromHead: true},
+		StreamPrefix:  "agent-",
+	})
+	assert.NoError(t, err)
+	defer r.Close()
+
+	var events []Event
+	for {
+		event, err := r.Next(context.Background())
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		events = append(events, event)
+	}
+
+	// The events are merged in timestamp order.
+	if assert.Equal(t, 3, len(events)) {
+		assert.Equal(t, "one", events[0].Message)
+		assert.Equal(t, "agent-1", events[0].Stream)
+		assert.Equal(t, time.Unix(1, 0), events[0].Timestamp)
+		assert.NotEmpty(t, events[0].ID)
+		assert.Equal(t, "two", events[1].Message)
+		assert.Equal(t, "agent-2", events[1].Stream)
+		assert.Equal(t, "three", events[2].Message)
+	}
+}
+
+func TestGroup_OpenAllOptions(t *testing.T) {
+	g, err := NewGroup("group", new(mockClient))
+	assert.NoError(t, err)
+
+	_, err = g.OpenAll(GroupReaderOptions{Streams: []string{"1234"}, StreamPrefix: "12"})
+	assert.Equal(t, errStreamsAndPrefix, err)
+
+	_, err = g.OpenAll(GroupReaderOptions{
+		ReaderOptions: ReaderOptions{Checkpointer: NewMemoryCheckpointer()},
+	})
+	assert.Equal(t, errCheckpointUnsupported, err)
+}
+
+func TestReader_Group(t *testing.T) {
+	c := new(mockClient)
+	r := &Reader{
+		group:  aws.String("group"),
+		client: c,
+		opts:   ReaderOptions{StartFromHead: true, Follow: true, EndTime: time.Unix(100, 0), Limiter: NewLimiter(nil)},
+		filter: &filterState{
+			streams: aws.StringSlice([]string{"1", "2"}),
+			overlap: time.Second,
+			seen:    make(map[string]time.Time),
+		},
+	}
+
+	event := func(id string, ms int64) *cloudwatchlogs.FilteredLogEvent {
+		return &cloudwatchlogs.FilteredLogEvent{
+			EventId:       aws.String(id),
+			LogStreamName: aws.String("1"),
+			Message:       aws.String(id),
+			Timestamp:     aws.Int64(ms),
+		}
+	}
+
+	c.On("FilterLogEvents", &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:   aws.String("group"),
+		LogStreamNames: aws.StringSlice([]string{"1", "2"}),
+		EndTime:        aws.Int64(99999),
+	}).Once().Return(&cloudwatchlogs.FilterLogEventsOutput{
+		Events:    []*cloudwatchlogs.FilteredLogEvent{event("b", 5000), event("a", 4000)},
+		NextToken: aws.String("next"),
+	}, nil)
+
+	c.On("FilterLogEvents", &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:   aws.String("group"),
+		LogStreamNames: aws.StringSlice([]string{"1", "2"}),
+		EndTime:        aws.Int64(99999),
+		NextToken:      aws.String("next"),
+	}).Once().Return(&cloudwatchlogs.FilterLogEventsOutput{
+		Events: []*cloudwatchlogs.FilteredLogEvent{event("c", 6000)},
+	}, nil)
+
+	// The next poll overlaps the last one, and returns an event that was
+	// ingested late.
+	c.On("FilterLogEvents", &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:   aws.String("group"),
+		LogStreamNames: aws.StringSlice([]string{"1", "2"}),
+		StartTime:      aws.Int64(5000),
+		EndTime:        aws.Int64(99999),
+	}).Once().Return(&cloudwatchlogs.FilterLogEventsOutput{
+		Events: []*cloudwatchlogs.FilteredLogEvent{event("b", 5000), event("late", 5500), event("c", 6000)},
+	}, nil)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, r.read(context.Background()))
+	}
+
+	var ids []string
+	for i := 0; i < 4; i++ {
+		event, err := r.Next(context.Background())
+		assert.NoError(t, err)
+		ids = append(ids, event.ID)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "late"}, ids)
+
+	// Events before the overlap are forgotten.
+	assert.NotContains(t, r.filter.seen, "a")
+
+	c.AssertExpectations(t)
+}
+
+func TestReader_GroupStartTime(t *testing.T) {
+	defer func(n func() time.Time) { now = n }(now)
+	now = func() time.Time { return time.Unix(3600, 0) }
+
+	c := new(mockClient)
+	opts := ReaderOptions{StartTime: time.Unix(60, 0), Limiter: NewLimiter(nil)}
+	r := &Reader{
+		group:  aws.String("group"),
+		client: c,
+		opts:   opts,
+		filter: newFilterState(GroupReaderOptions{ReaderOptions: opts}),
+	}
+
+	// StartTime is honoured, rather than starting from the most recent
+	// events.
+	c.On("FilterLogEvents", &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName: aws.String("group"),
+		StartTime:    aws.Int64(60000),
+	}).Once().Return(&cloudwatchlogs.FilterLogEventsOutput{}, nil)
+
+	assert.Equal(t, io.EOF, r.read(context.Background()))
+
+	c.AssertExpectations(t)
+}
@@ -0,0 +1,199 @@
+package cloudwatch
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// DefaultRates are the maximum rates, in requests per second, at which
+// CloudWatch Logs accepts requests from an account to the APIs that Readers
+// use.
+var DefaultRates = map[string]float64{
+	"GetLogEvents":       float64(time.Second / readThrottle),
+	"FilterLogEvents":    5,
+	"DescribeLogStreams": 5,
+}
+
+const (
+	// When a request is throttled, the rate is halved, down to a sixteenth
+	// of the maximum.
+	minRateFraction = 1.0 / 16
+
+	// Each successful request increases the rate by a twentieth of the
+	// maximum.
+	rateIncreaseFraction = 1.0 / 20
+)
+
+// Limiter limits the rate of requests to each CloudWatch Logs API with a
+// token bucket. It adapts to the limits CloudWatch Logs enforces: the rate is
+// halved each time a request is throttled, and increases again, up to the
+// maximum, as requests succeed.
+//
+// CloudWatch Logs limits requests per account, so every Reader that makes
+// requests for an account should share a Limiter. By default, Readers share
+// a Limiter per client. A Limiter is safe for concurrent use.
+type Limiter struct {
+	sync.Mutex
+	rates   map[string]float64
+	buckets map[string]*bucket
+
+	// now can be replaced in tests.
+	now func() time.Time
+}
+
+// bucket is the token bucket for an API.
+type bucket struct {
+	max, rate float64
+	tokens    float64
+	last      time.Time
+}
+
+// NewLimiter returns a Limiter that allows up to the given rates, in requests
+// per second, by API. Requests to APIs without a rate aren't limited. If rates
+// is nil, DefaultRates is used.
+func NewLimiter(rates map[string]float64) *Limiter {
+	if rates == nil {
+		rates = DefaultRates
+	}
+	return &Limiter{
+		rates:   rates,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// limiters are the Limiters shared by the Readers that use each client. They
+// are counted, so that each is dropped once every Reader using it is closed.
+var limiters = struct {
+	sync.Mutex
+	m map[Client]*sharedLimiter
+}{m: make(map[Client]*sharedLimiter)}
+
+type sharedLimiter struct {
+	*Limiter
+	refs int
+}
+
+// acquireLimiter returns the Limiter for the Readers that use client, and a
+// func that releases it when the Reader is closed.
+func acquireLimiter(client Client) (*Limiter, func()) {
+	// Clients that can't be map keys get their own Limiter.
+	if client == nil || !reflect.TypeOf(client).Comparable() {
+		return NewLimiter(nil), func() {}
+	}
+
+	limiters.Lock()
+	defer limiters.Unlock()
+
+	l, ok := limiters.m[client]
+	if !ok {
+		l = &sharedLimiter{Limiter: NewLimiter(nil)}
+		limiters.m[client] = l
+	}
+	l.refs++
+	return l.Limiter, func() { releaseLimiter(client, l) }
+}
+
+// releaseLimiter drops a reference to the Limiter shared by the Readers that
+// use client, and forgets it once there are none left.
+func releaseLimiter(client Client, l *sharedLimiter) {
+	limiters.Lock()
+	defer limiters.Unlock()
+
+	l.refs--
+	if l.refs == 0 && limiters.m[client] == l {
+		delete(limiters.m, client)
+	}
+}
+
+// Wait blocks until a request can be made to api, or ctx is done.
+func (l *Limiter) Wait(ctx context.Context, api string) error {
+	if d := l.reserve(api); d > 0 {
+		if err := sleep(ctx, d); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// reserve takes a token from the bucket for api, and returns how long to wait
+// until it's available. Tokens are handed out in order, so the bucket goes
+// negative while requests are waiting.
+func (l *Limiter) reserve(api string) time.Duration {
+	l.Lock()
+	defer l.Unlock()
+
+	b := l.bucket(api)
+	if b == nil {
+		return 0
+	}
+
+	now := l.now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > 1 {
+		b.tokens = 1
+	}
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Record adapts the rate for api to the result of a request.
+func (l *Limiter) Record(api string, err error) {
+	l.Lock()
+	defer l.Unlock()
+
+	b := l.bucket(api)
+	if b == nil {
+		return
+	}
+
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == throttlingCode {
+		b.rate /= 2
+		if min := b.max * minRateFraction; b.rate < min {
+			b.rate = min
+		}
+		return
+	}
+	if err == nil {
+		b.rate += b.max * rateIncreaseFraction
+		if b.rate > b.max {
+			b.rate = b.max
+		}
+	}
+}
+
+// Rate returns the current rate for api, in requests per second, or 0 if it
+// isn't limited.
+func (l *Limiter) Rate(api string) float64 {
+	l.Lock()
+	defer l.Unlock()
+
+	if b := l.bucket(api); b != nil {
+		return b.rate
+	}
+	return 0
+}
+
+func (l *Limiter) bucket(api string) *bucket {
+	b, ok := l.buckets[api]
+	if ok {
+		return b
+	}
+
+	max, ok := l.rates[api]
+	if !ok || max <= 0 {
+		return nil
+	}
+	b = &bucket{max: max, rate: max, tokens: 1, last: l.now()}
+	l.buckets[api] = b
+	return b
+}
@@ -0,0 +1,134 @@
+package cloudwatch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/eltorocorp/cloudwatch/cloudwatchtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	clock := time.Unix(0, 0)
+	var slept []time.Duration
+
+	defer func(s func(context.Context, time.Duration) error) { sleep = s }(sleep)
+	sleep = func(_ context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+
+	l := NewLimiter(map[string]float64{"GetLogEvents": 10})
+	l.now = func() time.Time { return clock }
+	wait := func(api string) {
+		assert.NoError(t, l.Wait(context.Background(), api))
+	}
+
+	// The first request goes straight away, and the next ones are spaced
+	// out.
+	wait("GetLogEvents")
+	wait("GetLogEvents")
+	wait("GetLogEvents")
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}, slept)
+
+	// Tokens build up over time.
+	clock = clock.Add(time.Second)
+	slept = nil
+	wait("GetLogEvents")
+	assert.Empty(t, slept)
+
+	// Other APIs aren't limited.
+	wait("PutLogEvents")
+	assert.Empty(t, slept)
+	assert.Equal(t, float64(0), l.Rate("PutLogEvents"))
+
+	// The rate halves when requests are throttled, and recovers as they
+	// succeed.
+	throttled := awserr.New(throttlingCode, "Rate exceeded", nil)
+	l.Record("GetLogEvents", throttled)
+	assert.Equal(t, float64(5), l.Rate("GetLogEvents"))
+	for i := 0; i < 10; i++ {
+		l.Record("GetLogEvents", throttled)
+	}
+	assert.Equal(t, 10*minRateFraction, l.Rate("GetLogEvents"))
+
+	l.Record("GetLogEvents", nil)
+	assert.Equal(t, 10*(minRateFraction+rateIncreaseFraction), l.Rate("GetLogEvents"))
+	for i := 0; i < 20; i++ {
+		l.Record("GetLogEvents", nil)
+	}
+	assert.Equal(t, float64(10), l.Rate("GetLogEvents"))
+
+	// Other errors don't change the rate.
+	l.Record("GetLogEvents", awserr.New("ResourceNotFoundException", "", nil))
+	assert.Equal(t, float64(10), l.Rate("GetLogEvents"))
+}
+
+func TestLimiter_Context(t *testing.T) {
+	l := NewLimiter(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The first request has a token, but the second has to wait.
+	assert.Equal(t, context.Canceled, l.Wait(ctx, "GetLogEvents"))
+	assert.Equal(t, context.Canceled, l.Wait(ctx, "GetLogEvents"))
+}
+
+func TestLimiter_Shared(t *testing.T) {
+	f := cloudwatchtest.New()
+	l1, release1 := acquireLimiter(f)
+	l2, release2 := acquireLimiter(f)
+	assert.True(t, l1 == l2)
+	other, releaseOther := acquireLimiter(cloudwatchtest.New())
+	assert.False(t, l1 == other)
+	releaseOther()
+
+	// Clients that can't be map keys, including nil, get their own.
+	unshared, _ := acquireLimiter(nil)
+	assert.NotNil(t, unshared)
+
+	// The Limiter is dropped once every Reader using it is closed.
+	release1()
+	assert.Contains(t, limiters.m, Client(f))
+	release2()
+	assert.NotContains(t, limiters.m, Client(f))
+
+	g, err := NewGroup("group", f)
+	assert.NoError(t, err)
+	r1, err := g.Open("1")
+	assert.NoError(t, err)
+	r2, err := g.Open("2")
+	assert.NoError(t, err)
+	assert.True(t, r1.opts.Limiter == r2.opts.Limiter)
+
+	assert.NoError(t, r1.Close())
+	assert.NoError(t, r2.Close())
+	assert.NotContains(t, limiters.m, Client(f))
+}
+
+func TestReader_Throttled(t *testing.T) {
+	f := cloudwatchtest.New()
+	f.Now = now
+
+	g, err := AttachGroup("group", f)
+	assert.NoError(t, err)
+	w, err := g.AttachStream("1234")
+	assert.NoError(t, err)
+	w.Write([]byte("Hello\n"))
+	assert.NoError(t, w.Close())
+
+	// Throttled requests slow the Reader down, rather than failing it.
+	f.Throttle("GetLogEvents", 2)
+	l := NewLimiter(nil)
+	r, err := g.OpenWithOptions("1234", ReaderOptions{StartFromHead: true, Limiter: l})
+	assert.NoError(t, err)
+	defer r.Close()
+
+	b := make([]byte, 100)
+	n, err := r.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello\n", string(b[:n]))
+	assert.True(t, l.Rate("GetLogEvents") < DefaultRates["GetLogEvents"])
+}
@@ -0,0 +1,105 @@
+package cloudwatch
+
+import (
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// defaultIdleTimeout is how long a multi-line event waits for more lines when
+// MultilineOptions.IdleTimeout isn't set.
+const defaultIdleTimeout = time.Second
+
+// DefaultContinuation matches the continuation lines of common stack traces:
+// indented lines, Go's "goroutine N [" headers and Java's "Caused by:".
+var DefaultContinuation = regexp.MustCompile(`^(\s|goroutine \d+ \[|Caused by:)`)
+
+// MultilineOptions configures how a Writer folds several lines, such as a
+// stack trace, into a single event.
+type MultilineOptions struct {
+	// Start matches the first line of an event. Lines that don't match are
+	// added to the previous event.
+	Start *regexp.Regexp
+
+	// Continuation matches lines that are added to the previous event. It is
+	// only used if Start is nil, and defaults to DefaultContinuation.
+	Continuation *regexp.Regexp
+
+	// IdleTimeout is how long an event waits for more lines before it is
+	// buffered to be sent. Defaults to one second.
+	IdleTimeout time.Duration
+}
+
+// multiline folds lines into multi-line events.
+type multiline struct {
+	opts MultilineOptions
+
+	sync.Mutex
+	pending *cloudwatchlogs.InputLogEvent
+	updated time.Time
+}
+
+func newMultiline(opts MultilineOptions) *multiline {
+	if opts.Start == nil && opts.Continuation == nil {
+		opts.Continuation = DefaultContinuation
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = defaultIdleTimeout
+	}
+	return &multiline{opts: opts}
+}
+
+// continues returns true if line belongs to the previous event.
+func (m *multiline) continues(line string) bool {
+	if m.opts.Start != nil {
+		return !m.opts.Start.MatchString(line)
+	}
+	return m.opts.Continuation.MatchString(line)
+}
+
+// add adds a line, returning the previous event if line starts a new one.
+// event is used to create the log event for the first line of an event.
+func (m *multiline) add(line string, event func(string) *cloudwatchlogs.InputLogEvent) *cloudwatchlogs.InputLogEvent {
+	m.Lock()
+	defer m.Unlock()
+
+	m.updated = now()
+
+	if m.pending != nil && m.continues(line) &&
+		len(*m.pending.Message)+len(line) <= maximumBytesPerEvent {
+		m.pending.Message = aws.String(*m.pending.Message + line)
+		return nil
+	}
+
+	previous := m.pending
+	m.pending = event(line)
+	return previous
+}
+
+// flush returns the pending event, if there is one.
+func (m *multiline) flush() *cloudwatchlogs.InputLogEvent {
+	m.Lock()
+	defer m.Unlock()
+
+	pending := m.pending
+	m.pending = nil
+	return pending
+}
+
+// idle returns the pending event if no lines have been added to it for
+// IdleTimeout.
+func (m *multiline) idle() *cloudwatchlogs.InputLogEvent {
+	m.Lock()
+	defer m.Unlock()
+
+	if now().Sub(m.updated) < m.opts.IdleTimeout {
+		return nil
+	}
+
+	pending := m.pending
+	m.pending = nil
+	return pending
+}
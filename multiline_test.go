@@ -0,0 +1,89 @@
+package cloudwatch
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter_Multiline(t *testing.T) {
+	c := new(mockClient)
+	w := &Writer{
+		group:     aws.String("group"),
+		stream:    aws.String("1234"),
+		client:    c,
+		core:      newStreamCore(),
+		multiline: newMultiline(MultilineOptions{}),
+	}
+
+	c.On("PutLogEvents", &cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("Starting\n"), Timestamp: aws.Int64(1000)},
+			{Message: aws.String("panic: boom\n\ngoroutine 1 [running]:\n\tmain.go:12\n"), Timestamp: aws.Int64(1000)},
+			{Message: aws.String("Exception: boom\n  at Main.java:3\nCaused by: bang\n"), Timestamp: aws.Int64(1000)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	}).Return(&cloudwatchlogs.PutLogEventsOutput{}, nil)
+
+	_, err := io.WriteString(w, "Starting\npanic: boom\n\ngoroutine 1 [running]:\n\tmain.go:12\n")
+	assert.NoError(t, err)
+	_, err = io.WriteString(w, "Exception: boom\n  at Main.java:3\nCaused by: bang\n")
+	assert.NoError(t, err)
+
+	// The last event is held back until Flush, in case more lines follow.
+	err = w.Flush()
+	assert.NoError(t, err)
+
+	c.AssertExpectations(t)
+}
+
+func TestMultiline_Start(t *testing.T) {
+	m := newMultiline(MultilineOptions{Start: regexp.MustCompile(`^\[`)})
+
+	var events []*cloudwatchlogs.InputLogEvent
+	for _, line := range []string{"[1] a\n", "b\n", "[2] c\n", "d\n"} {
+		if event := m.add(line, (&Writer{}).event); event != nil {
+			events = append(events, event)
+		}
+	}
+	events = append(events, m.flush())
+
+	assert.Equal(t, []string{"[1] a\nb\n", "[2] c\nd\n"}, messages(events))
+}
+
+func TestMultiline_MaximumBytes(t *testing.T) {
+	m := newMultiline(MultilineOptions{})
+
+	line := " " + strings.Repeat("a", maximumBytesPerEvent/2)
+	assert.Nil(t, m.add("first\n", (&Writer{}).event))
+	assert.Nil(t, m.add(line, (&Writer{}).event))
+
+	// Adding another line would make the event too large.
+	event := m.add(line, (&Writer{}).event)
+	if assert.NotNil(t, event) {
+		assert.Equal(t, "first\n"+line, *event.Message)
+	}
+}
+
+func TestMultiline_Idle(t *testing.T) {
+	m := newMultiline(MultilineOptions{IdleTimeout: time.Second})
+	m.add("Hello\n", (&Writer{}).event)
+
+	assert.Nil(t, m.idle())
+
+	defer func(n func() time.Time) { now = n }(now)
+	now = func() time.Time { return time.Unix(2, 0) }
+
+	event := m.idle()
+	if assert.NotNil(t, event) {
+		assert.Equal(t, "Hello\n", *event.Message)
+	}
+	assert.Nil(t, m.flush())
+}
@@ -0,0 +1,104 @@
+package cloudwatch
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// OversizePolicy determines what a Writer does with a log event whose message
+// is larger than CloudWatch Logs accepts.
+type OversizePolicy int
+
+const (
+	// OversizeSplit splits the message into several events, each suffixed
+	// with its part number, e.g. " [1/3]". This is the default.
+	OversizeSplit OversizePolicy = iota
+
+	// OversizeTruncate truncates the message and appends
+	// WriterOptions.TruncateMarker.
+	OversizeTruncate
+
+	// OversizeHandler passes the event to WriterOptions.OnOversize instead of
+	// sending it.
+	OversizeHandler
+)
+
+const (
+	// defaultTruncateMarker is appended to truncated messages when no marker
+	// is configured.
+	defaultTruncateMarker = "...[truncated]"
+
+	// partMarkerBytes is the number of bytes reserved in each part of a split
+	// message for its " [i/n]" suffix.
+	partMarkerBytes = 24
+
+	// maximumTruncateMarkerBytes is the longest TruncateMarker used, so that
+	// truncated messages keep most of their content.
+	maximumTruncateMarkerBytes = 1024
+)
+
+// fit applies the writer's OversizePolicy to event, returning the events that
+// should be buffered in its place.
+func (w *Writer) fit(event *cloudwatchlogs.InputLogEvent) []*cloudwatchlogs.InputLogEvent {
+	message := *event.Message
+	if len(message) <= maximumBytesPerEvent {
+		return []*cloudwatchlogs.InputLogEvent{event}
+	}
+
+	switch w.opts.Oversize {
+	case OversizeTruncate:
+		marker := w.opts.TruncateMarker
+		if marker == "" {
+			marker = defaultTruncateMarker
+		}
+		head, _ := splitUTF8(message, maximumBytesPerEvent-len(marker))
+		return []*cloudwatchlogs.InputLogEvent{{
+			Message:   aws.String(head + marker),
+			Timestamp: event.Timestamp,
+		}}
+	case OversizeHandler:
+		if w.opts.OnOversize != nil {
+			w.opts.OnOversize(event)
+		}
+		return nil
+	}
+
+	var parts []string
+	for len(message) > 0 {
+		var part string
+		part, message = splitUTF8(message, maximumBytesPerEvent-partMarkerBytes)
+		parts = append(parts, part)
+	}
+
+	events := make([]*cloudwatchlogs.InputLogEvent, len(parts))
+	for i, part := range parts {
+		events[i] = &cloudwatchlogs.InputLogEvent{
+			Message:   aws.String(fmt.Sprintf("%s [%d/%d]", part, i+1, len(parts))),
+			Timestamp: event.Timestamp,
+		}
+	}
+	return events
+}
+
+// splitUTF8 splits s into a head of at most n bytes and the remaining tail,
+// without cutting a multi-byte rune in half.
+func splitUTF8(s string, n int) (head, tail string) {
+	if len(s) <= n {
+		return s, ""
+	}
+
+	// Back off to the start of the rune that straddles the limit. If s isn't
+	// valid UTF-8 there may not be one, in which case cut at n.
+	i := n
+	for i > n-utf8.UTFMax && i > 0 && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	if !utf8.RuneStart(s[i]) || i == 0 {
+		i = n
+	}
+
+	return s[:i], s[i:]
+}
@@ -0,0 +1,100 @@
+package cloudwatch
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter_OversizeSplit(t *testing.T) {
+	w := &Writer{}
+
+	// "€" is three bytes, so the limit falls in the middle of a rune.
+	message := strings.Repeat("€", maximumBytesPerEvent/3+10)
+	events := w.fit(&cloudwatchlogs.InputLogEvent{
+		Message:   aws.String(message),
+		Timestamp: aws.Int64(1000),
+	})
+	assert.Equal(t, 2, len(events))
+
+	var joined string
+	for i, event := range events {
+		assert.True(t, len(*event.Message) <= maximumBytesPerEvent)
+		assert.True(t, utf8.ValidString(*event.Message))
+		assert.Equal(t, int64(1000), *event.Timestamp)
+
+		suffix := []string{" [1/2]", " [2/2]"}[i]
+		assert.True(t, strings.HasSuffix(*event.Message, suffix))
+		joined += strings.TrimSuffix(*event.Message, suffix)
+	}
+	assert.Equal(t, message, joined)
+}
+
+func TestWriter_OversizeTruncate(t *testing.T) {
+	w := &Writer{opts: WriterOptions{Oversize: OversizeTruncate}}
+
+	events := w.fit(&cloudwatchlogs.InputLogEvent{
+		Message:   aws.String(strings.Repeat("€", maximumBytesPerEvent)),
+		Timestamp: aws.Int64(1000),
+	})
+	assert.Equal(t, 1, len(events))
+	assert.True(t, len(*events[0].Message) <= maximumBytesPerEvent)
+	assert.True(t, utf8.ValidString(*events[0].Message))
+	assert.True(t, strings.HasSuffix(*events[0].Message, defaultTruncateMarker))
+}
+
+func TestWriter_OversizeTruncateMarker(t *testing.T) {
+	// A marker as large as an event is cut short, rather than leaving no
+	// room for the message.
+	w := NewWriter("group", "1234", new(mockClient), WriterOptions{
+		Oversize:       OversizeTruncate,
+		TruncateMarker: strings.Repeat("€", maximumBytesPerEvent),
+	})
+	defer w.Close()
+	assert.True(t, len(w.opts.TruncateMarker) <= maximumTruncateMarkerBytes)
+	assert.True(t, utf8.ValidString(w.opts.TruncateMarker))
+
+	events := w.fit(&cloudwatchlogs.InputLogEvent{
+		Message:   aws.String(strings.Repeat("a", maximumBytesPerEvent+1)),
+		Timestamp: aws.Int64(1000),
+	})
+	assert.Equal(t, 1, len(events))
+	assert.True(t, len(*events[0].Message) <= maximumBytesPerEvent)
+	assert.True(t, strings.HasPrefix(*events[0].Message, "a"))
+	assert.True(t, strings.HasSuffix(*events[0].Message, w.opts.TruncateMarker))
+}
+
+func TestWriter_OversizeHandler(t *testing.T) {
+	var handled []*cloudwatchlogs.InputLogEvent
+	w := &Writer{opts: WriterOptions{
+		Oversize: OversizeHandler,
+		OnOversize: func(event *cloudwatchlogs.InputLogEvent) {
+			handled = append(handled, event)
+		},
+	}}
+
+	event := &cloudwatchlogs.InputLogEvent{
+		Message:   aws.String(strings.Repeat("a", maximumBytesPerEvent+1)),
+		Timestamp: aws.Int64(1000),
+	}
+	assert.Empty(t, w.fit(event))
+	assert.Equal(t, []*cloudwatchlogs.InputLogEvent{event}, handled)
+
+	// Events within the limit are left alone.
+	small := &cloudwatchlogs.InputLogEvent{Message: aws.String("Hello"), Timestamp: aws.Int64(1000)}
+	assert.Equal(t, []*cloudwatchlogs.InputLogEvent{small}, w.fit(small))
+}
+
+func TestSplitUTF8(t *testing.T) {
+	head, tail := splitUTF8("a€b", 2)
+	assert.Equal(t, "a", head)
+	assert.Equal(t, "€b", tail)
+
+	head, tail = splitUTF8("abc", 5)
+	assert.Equal(t, "abc", head)
+	assert.Equal(t, "", tail)
+}
@@ -1,71 +1,241 @@
 package cloudwatch
 
 import (
-	"bytes"
+	"context"
+	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
-
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 )
 
 // Reader is an io.Reader implementation that streams log lines from cloudwatch
-// logs.
+// logs. Events can also be read one at a time, with their metadata, using
+// Next.
 type Reader struct {
 	group, stream, nextToken *string
 
-	client cloudwatchlogsiface.CloudWatchLogsAPI
+	client Client
+	opts   ReaderOptions
+
+	// filter is set for Readers of several streams, or with a FilterPattern,
+	// which read events with FilterLogEvents rather than GetLogEvents.
+	filter *filterState
+
+	// follow is set for Readers that follow the streams of a group, and
+	// label prefixes the messages returned by Read with their streams.
+	follow *followState
+	label  bool
+
+	// events are the events that have been read from the stream but not yet
+	// returned by Next or Read, and partial is the rest of the message of an
+	// event that Read has returned part of.
+	lock    sync.Mutex
+	events  []bufferedEvent
+	partial []byte
+
+	// partialCheckpoint is the checkpoint to save once partial has been
+	// read.
+	partialCheckpoint *pageCheckpoint
+
+	// page counts the pages of events read, and lastTimestamp is the latest
+	// timestamp in them. They are only used by the polling goroutine.
+	page          int64
+	lastTimestamp time.Time
+
+	// checkpointed is the last page whose checkpoint was saved.
+	checkpointLock sync.Mutex
+	checkpointed   int64
+
+	// ready is signalled when events are added, or an error occurs, to wake
+	// a blocked Read or Next.
+	ready chan struct{}
 
-	throttle <-chan time.Time
+	// ctx is used for requests, and is cancelled by Close. done is ctx.Done,
+	// and stopped is closed when the polling goroutine exits.
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    <-chan struct{}
+	stopped chan struct{}
 
-	b lockingBuffer
+	closed int32 // Accessed atomically.
+
+	// release gives back the Limiter shared with the other Readers that use
+	// the client, if the Reader is using it.
+	release func()
 
 	// If an error occurs when getting events from the stream, this will be
 	// populated and subsequent calls to Read will return the error.
-	err error
+	errLock sync.Mutex
+	err     error
 }
 
-func NewReader(group, stream string, client cloudwatchlogsiface.CloudWatchLogsAPI) *Reader {
-	return newReader(group, stream, client)
+// ReaderOptions configures a Reader.
+type ReaderOptions struct {
+	// StartTime and EndTime limit the events read to those with timestamps
+	// in [StartTime, EndTime). Zero values leave the range open.
+	StartTime, EndTime time.Time
+
+	// StartFromHead reads the stream from its oldest event. Otherwise, the
+	// Reader starts with the most recent page of events, like tail.
+	StartFromHead bool
+
+	// Follow keeps polling the stream for new events once the end has been
+	// reached. Otherwise, the Reader returns io.EOF once it has returned
+	// every event.
+	Follow bool
+
+	// Checkpointer, if set, is used to resume from the checkpoint saved for
+	// the stream, and to save a new checkpoint as events are returned by
+	// Read or Next.
+	//
+	// Checkpoints are saved at the end of each page of events, so a Reader
+	// that resumes may return some events again. If the checkpoint's token
+	// has expired, the Reader resumes from its timestamp instead, and
+	// returns the events with that timestamp again.
+	Checkpointer Checkpointer
+
+	// FilterPattern, if set, limits the events read to those that match it,
+	// using the CloudWatch Logs filter pattern syntax. The events are
+	// filtered by CloudWatch Logs, with FilterLogEvents, so only the matching
+	// events are fetched. See the filterpattern package for the syntax.
+	//
+	// A Checkpointer can't be used with a FilterPattern.
+	FilterPattern string
+
+	// Limiter limits the rate of the Reader's requests. By default, Readers
+	// that use the same client share a Limiter. Readers that use different
+	// clients for the same account should be given the same Limiter, as
+	// CloudWatch Logs limits requests per account.
+	Limiter *Limiter
 }
 
-func newReader(group, stream string, client cloudwatchlogsiface.CloudWatchLogsAPI) *Reader {
+// NewReader returns a Reader that reads the given stream from the head, and
+// polls for new events until it is closed.
+func NewReader(group, stream string, client Client) *Reader {
+	return NewReaderWithOptions(group, stream, client, ReaderOptions{
+		StartFromHead: true,
+		Follow:        true,
+	})
+}
+
+// NewReaderWithOptions returns a Reader for the given stream that is
+// configured with opts.
+func NewReaderWithOptions(group, stream string, client Client, opts ReaderOptions) *Reader {
+	return newReader(group, stream, client, opts)
+}
+
+func newReader(group, stream string, client Client, opts ReaderOptions) *Reader {
 	r := &Reader{
-		group:    aws.String(group),
-		stream:   aws.String(stream),
-		client:   client,
-		throttle: time.Tick(readThrottle),
+		group:  aws.String(group),
+		stream: aws.String(stream),
+		client: client,
+		opts:   opts,
+	}
+	if opts.FilterPattern != "" {
+		r.filter = newFilterState(GroupReaderOptions{
+			ReaderOptions: opts,
+			Streams:       []string{stream},
+		})
+	}
+	return startReader(r)
+}
+
+// startReader starts r polling for events.
+func startReader(r *Reader) *Reader {
+	ctx, cancel := context.WithCancel(context.Background())
+	if r.opts.Limiter == nil {
+		r.opts.Limiter, r.release = acquireLimiter(r.client)
 	}
+	r.ready = make(chan struct{}, 1)
+	r.ctx = ctx
+	r.cancel = cancel
+	r.done = ctx.Done()
+	r.stopped = make(chan struct{})
 	go r.start()
 	return r
 }
 
+// start polls for events until done is closed, an error occurs or, when not
+// following the stream, the end of the stream is reached.
 func (r *Reader) start() {
+	defer close(r.stopped)
+
+	if err := r.resume(); err != nil {
+		r.setErr(err)
+		return
+	}
+
+	// The Limiter paces the requests.
 	for {
-		<-r.throttle
-		if r.err = r.read(); r.err != nil {
+		if err := r.read(r.ctx); err != nil {
+			// Requests fail when Close cancels them, which isn't an error.
+			if r.ctx.Err() != nil {
+				return
+			}
+			// The Limiter slows down when requests are throttled, so
+			// carry on.
+			if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == throttlingCode {
+				continue
+			}
+			// Reaching the end of the stream is reported as io.EOF.
+			r.setErr(err)
 			return
 		}
 	}
 }
 
-func (r *Reader) read() error {
+// limit waits for the Limiter before calling call to make a request to api,
+// and records the result.
+func (r *Reader) limit(ctx context.Context, api string, call func() error) error {
+	l := r.opts.Limiter
+	if err := l.Wait(ctx, api); err != nil {
+		return err
+	}
+	err := call()
+	l.Record(api, err)
+	return err
+}
+
+func (r *Reader) read(ctx context.Context) error {
+	if r.filter != nil {
+		return r.readFilter(ctx)
+	}
+	if r.follow != nil {
+		return r.readFollow(ctx)
+	}
 
 	params := &cloudwatchlogs.GetLogEventsInput{
 		LogGroupName:  r.group,
 		LogStreamName: r.stream,
-		StartFromHead: aws.Bool(true),
 		NextToken:     r.nextToken,
+		// CloudWatch Logs requires StartFromHead with a forward token.
+		StartFromHead: aws.Bool(r.opts.StartFromHead || r.nextToken != nil),
+	}
+	if !r.opts.StartTime.IsZero() {
+		params.StartTime = aws.Int64(timestamp(r.opts.StartTime))
+	}
+	if !r.opts.EndTime.IsZero() {
+		params.EndTime = aws.Int64(timestamp(r.opts.EndTime))
 	}
 
-	resp, err := r.client.GetLogEvents(params)
-
+	var resp *cloudwatchlogs.GetLogEventsOutput
+	err := r.limit(ctx, "GetLogEvents", func() (err error) {
+		resp, err = r.client.GetLogEventsWithContext(ctx, params)
+		return err
+	})
 	if err != nil {
 		return err
 	}
 
+	// The forward token stays the same once the end of the stream has been
+	// reached.
+	end := resp.NextForwardToken == nil ||
+		(r.nextToken != nil && *resp.NextForwardToken == *r.nextToken)
+
 	// We want to re-use the existing token in the event that
 	// NextForwardToken is nil, which means there's no new messages to
 	// consume.
@@ -73,49 +243,286 @@ func (r *Reader) read() error {
 		r.nextToken = resp.NextForwardToken
 	}
 
-	// If there are no messages, return so that the consumer can read again.
-	if len(resp.Events) == 0 {
-		return nil
+	var checkpoint *pageCheckpoint
+	if !end && r.opts.Checkpointer != nil {
+		checkpoint = r.nextCheckpoint(resp.Events)
 	}
 
-	for _, event := range resp.Events {
-		r.b.WriteString(*event.Message)
+	events := make([]Event, len(resp.Events))
+	for i, event := range resp.Events {
+		events[i] = Event{
+			Timestamp: eventTime(aws.Int64Value(event.Timestamp)),
+			Message:   aws.StringValue(event.Message),
+			Stream:    *r.stream,
+		}
+		if event.IngestionTime != nil {
+			events[i].IngestionTime = eventTime(*event.IngestionTime)
+		}
 	}
+	r.add(events, checkpoint)
 
+	if end && !r.opts.Follow {
+		return io.EOF
+	}
 	return nil
 }
 
-func (r *Reader) Read(b []byte) (int, error) {
-	// Return the AWS error if there is one.
-	if r.err != nil {
-		return 0, r.err
+// add buffers events to be returned by Read or Next. If checkpoint is set,
+// it is saved once the last of the events has been returned.
+func (r *Reader) add(events []Event, checkpoint *pageCheckpoint) {
+	if len(events) == 0 {
+		if checkpoint != nil {
+			r.emptyPage(checkpoint)
+		}
+		return
+	}
+
+	r.lock.Lock()
+	for _, event := range events {
+		r.events = append(r.events, bufferedEvent{Event: event})
+	}
+	r.events[len(r.events)-1].checkpoint = checkpoint
+	r.lock.Unlock()
+	r.notify()
+}
+
+// emptyPage handles the checkpoint of a page with no events, which belongs
+// with the last buffered event, or can be saved now if there isn't one.
+func (r *Reader) emptyPage(checkpoint *pageCheckpoint) {
+	r.lock.Lock()
+	switch {
+	case len(r.events) > 0:
+		r.events[len(r.events)-1].checkpoint = checkpoint
+		checkpoint = nil
+	case len(r.partial) > 0:
+		r.partialCheckpoint = checkpoint
+		checkpoint = nil
 	}
+	r.lock.Unlock()
+
+	r.checkpoint(checkpoint)
+}
+
+// Read reads log lines into b. If none are buffered, it blocks until there
+// are, an error occurs or the Reader is closed.
+func (r *Reader) Read(b []byte) (int, error) {
+	return r.ReadContext(context.Background(), b)
+}
 
-	// If there is not data right now, return. Reading from the buffer would
-	// result in io.EOF being returned, which is not what we want.
-	if r.b.Len() == 0 {
+// ReadContext is like Read, but gives up waiting for log lines when ctx is
+// done, and returns ctx.Err().
+func (r *Reader) ReadContext(ctx context.Context, b []byte) (int, error) {
+	if len(b) == 0 {
 		return 0, nil
 	}
 
-	return r.b.Read(b)
+	var n int
+	var checkpoint *pageCheckpoint
+	err := r.wait(ctx, func() bool {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+
+		for n < len(b) {
+			if len(r.partial) == 0 {
+				if len(r.events) == 0 {
+					break
+				}
+				r.partial = []byte(r.message(r.events[0].Event))
+				r.partialCheckpoint = r.events[0].checkpoint
+				r.events = r.events[1:]
+			}
+			c := copy(b[n:], r.partial)
+			r.partial = r.partial[c:]
+			n += c
+
+			if len(r.partial) == 0 && r.partialCheckpoint != nil {
+				checkpoint = r.partialCheckpoint
+				r.partialCheckpoint = nil
+			}
+		}
+		return n > 0
+	})
+	r.checkpoint(checkpoint)
+	return n, err
 }
 
-// lockingBuffer is a bytes.Buffer that locks Reads and Writes.
-type lockingBuffer struct {
-	sync.Mutex
-	bytes.Buffer
+// message returns the message of an event, as returned by Read.
+func (r *Reader) message(event Event) string {
+	if r.label {
+		return "[" + event.Stream + "] " + event.Message
+	}
+	return event.Message
 }
 
-func (r *lockingBuffer) Read(b []byte) (int, error) {
-	r.Lock()
-	defer r.Unlock()
+// Next returns the next event in the stream. If none are buffered, it blocks
+// until there is one, an error occurs, the Reader is closed or ctx is done.
+//
+// Next and Read consume the same events, so a Reader should only be used
+// with one or the other.
+func (r *Reader) Next(ctx context.Context) (Event, error) {
+	var event bufferedEvent
+	err := r.wait(ctx, func() bool {
+		r.lock.Lock()
+		defer r.lock.Unlock()
 
-	return r.Buffer.Read(b)
+		if len(r.events) == 0 {
+			return false
+		}
+		event = r.events[0]
+		r.events = r.events[1:]
+		return true
+	})
+	r.checkpoint(event.checkpoint)
+	return event.Event, err
 }
 
-func (r *lockingBuffer) Write(b []byte) (int, error) {
-	r.Lock()
-	defer r.Unlock()
+// wait calls take until it returns true, returning early if an error occurs,
+// the Reader is closed or ctx is done.
+func (r *Reader) wait(ctx context.Context, take func() bool) error {
+	for {
+		if atomic.LoadInt32(&r.closed) != 0 {
+			return io.ErrClosedPipe
+		}
+
+		if take() {
+			return nil
+		}
+
+		// Return the AWS error if there is one.
+		if err := r.getErr(); err != nil {
+			return err
+		}
+
+		select {
+		case <-r.ready:
+		case <-r.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Close stops the Reader polling for events. A blocked Read, and any
+// subsequent calls to Read, will return io.ErrClosedPipe.
+func (r *Reader) Close() error {
+	if !atomic.CompareAndSwapInt32(&r.closed, 0, 1) {
+		return nil
+	}
+
+	if r.cancel != nil {
+		r.cancel()
+		<-r.stopped
+	}
+	if r.release != nil {
+		r.release()
+	}
+	return nil
+}
+
+// notify wakes a blocked Read, if there is one.
+func (r *Reader) notify() {
+	select {
+	case r.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Reader) setErr(err error) {
+	r.errLock.Lock()
+	r.err = err
+	r.errLock.Unlock()
+	r.notify()
+}
+
+func (r *Reader) getErr() error {
+	r.errLock.Lock()
+	defer r.errLock.Unlock()
+
+	return r.err
+}
+
+// bufferedEvent is an event waiting to be returned by Read or Next. The last
+// event of each page carries the checkpoint to save once it has been
+// returned.
+type bufferedEvent struct {
+	Event
+	checkpoint *pageCheckpoint
+}
 
-	return r.Buffer.Write(b)
+// pageCheckpoint is the checkpoint for the end of a page of events.
+type pageCheckpoint struct {
+	Checkpoint
+	page int64
+}
+
+// nextCheckpoint returns the checkpoint for the end of the page of events
+// that was just read.
+func (r *Reader) nextCheckpoint(events []*cloudwatchlogs.OutputLogEvent) *pageCheckpoint {
+	for _, event := range events {
+		if t := eventTime(aws.Int64Value(event.Timestamp)); t.After(r.lastTimestamp) {
+			r.lastTimestamp = t
+		}
+	}
+
+	r.page++
+	return &pageCheckpoint{
+		Checkpoint: Checkpoint{
+			Token:     *r.nextToken,
+			Timestamp: r.lastTimestamp,
+		},
+		page: r.page,
+	}
+}
+
+// checkpoint saves checkpoint, unless a later one has already been saved.
+// Errors are logged rather than returned, so that a Reader carries on when
+// its checkpoints can't be saved.
+func (r *Reader) checkpoint(checkpoint *pageCheckpoint) {
+	if checkpoint == nil {
+		return
+	}
+
+	r.checkpointLock.Lock()
+	defer r.checkpointLock.Unlock()
+
+	if checkpoint.page <= r.checkpointed {
+		return
+	}
+
+	c := checkpoint.Checkpoint
+	c.Saved = now()
+	if err := r.opts.Checkpointer.Save(*r.group, *r.stream, c); err != nil {
+		FallbackLogger.Errorln("error saving checkpoint", *r.group, *r.stream, err)
+		return
+	}
+	r.checkpointed = checkpoint.page
+}
+
+// resume sets the Reader up to carry on from the stream's checkpoint, if it
+// has one.
+func (r *Reader) resume() error {
+	if r.opts.Checkpointer == nil {
+		return nil
+	}
+	if r.filter != nil || r.follow != nil {
+		return errCheckpointUnsupported
+	}
+
+	checkpoint, err := r.opts.Checkpointer.Load(*r.group, *r.stream)
+	if err != nil || checkpoint == nil {
+		return err
+	}
+
+	r.lastTimestamp = checkpoint.Timestamp
+	if checkpoint.Token != "" && now().Sub(checkpoint.Saved) < tokenExpiry {
+		r.nextToken = aws.String(checkpoint.Token)
+		return nil
+	}
+
+	// The token has expired, so start from the last event read instead.
+	if checkpoint.Timestamp.After(r.opts.StartTime) {
+		r.opts.StartTime = checkpoint.Timestamp
+	}
+	r.opts.StartFromHead = true
+	return nil
 }
@@ -2,12 +2,15 @@ package cloudwatch
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"io"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/eltorocorp/cloudwatch/cloudwatchtest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -17,6 +20,7 @@ func TestReader(t *testing.T) {
 		group:  aws.String("group"),
 		stream: aws.String("1234"),
 		client: c,
+		opts:   ReaderOptions{StartFromHead: true, Follow: true, Limiter: NewLimiter(nil)},
 	}
 
 	c.On("GetLogEvents", &cloudwatchlogs.GetLogEventsInput{
@@ -29,7 +33,7 @@ func TestReader(t *testing.T) {
 		},
 	}, nil)
 
-	err := r.read()
+	err := r.read(context.Background())
 	assert.NoError(t, err)
 
 	b := make([]byte, 1000)
@@ -46,6 +50,7 @@ func TestReader_Buffering(t *testing.T) {
 		group:  aws.String("group"),
 		stream: aws.String("1234"),
 		client: c,
+		opts:   ReaderOptions{StartFromHead: true, Follow: true, Limiter: NewLimiter(nil)},
 	}
 
 	c.On("GetLogEvents", &cloudwatchlogs.GetLogEventsInput{
@@ -58,7 +63,7 @@ func TestReader_Buffering(t *testing.T) {
 		},
 	}, nil)
 
-	err := r.read()
+	err := r.read(context.Background())
 	assert.NoError(t, err)
 
 	b := make([]byte, 3)
@@ -79,6 +84,7 @@ func TestReader_EndOfFile(t *testing.T) {
 		group:  aws.String("group"),
 		stream: aws.String("1234"),
 		client: c,
+		opts:   ReaderOptions{StartFromHead: true, Follow: true, Limiter: NewLimiter(nil)},
 	}
 
 	c.On("GetLogEvents", &cloudwatchlogs.GetLogEventsInput{
@@ -112,7 +118,7 @@ func TestReader_EndOfFile(t *testing.T) {
 		Events: []*cloudwatchlogs.OutputLogEvent{},
 	}, nil)
 
-	err := r.read()
+	err := r.read(context.Background())
 	assert.NoError(t, err)
 
 	b := make([]byte, 5)
@@ -120,19 +126,22 @@ func TestReader_EndOfFile(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 5, n)
 
-	err = r.read()
+	err = r.read(context.Background())
 	assert.NoError(t, err)
 
 	n, err = r.Read(b) //World
 	assert.NoError(t, err)
 	assert.Equal(t, 5, n)
 
-	err = r.read()
+	err = r.read(context.Background())
 	assert.NoError(t, err)
 
-	// Attempt to read more data, but there is none.
-	n, err = r.Read(b)
-	assert.NoError(t, err)
+	// Attempt to read more data, but there is none, so Read blocks until
+	// the context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	n, err = r.ReadContext(ctx, b)
+	assert.Equal(t, context.DeadlineExceeded, err)
 	assert.Equal(t, 0, n)
 
 	c.AssertExpectations(t)
@@ -152,9 +161,418 @@ func TestReader_Err(t *testing.T) {
 		},
 	}, errBoom)
 
-	r := newReader("group", "1234", c)
+	r := NewReader("group", "1234", c)
+	defer r.Close()
 
 	b := new(bytes.Buffer)
 	_, err := io.Copy(b, r)
 	assert.Equal(t, errBoom, err)
 }
+
+func TestReader_Blocks(t *testing.T) {
+	f := cloudwatchtest.New()
+	f.Now = now
+
+	g, err := AttachGroup("group", f)
+	assert.NoError(t, err)
+	w, err := g.AttachStream("1234")
+	assert.NoError(t, err)
+	defer w.Close()
+
+	r, err := g.Open("1234")
+	assert.NoError(t, err)
+	defer r.Close()
+
+	read := make(chan string)
+	go func() {
+		b := make([]byte, 100)
+		n, _ := r.Read(b)
+		read <- string(b[:n])
+	}()
+
+	select {
+	case <-read:
+		t.Fatal("expected Read to block")
+	case <-time.After(2 * readThrottle):
+	}
+
+	io.WriteString(w, "Hello\n")
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "Hello\n", <-read)
+}
+
+func TestReader_Close(t *testing.T) {
+	f := cloudwatchtest.New()
+	f.Now = now
+
+	g, err := AttachGroup("group", f)
+	assert.NoError(t, err)
+	w, err := g.AttachStream("1234")
+	assert.NoError(t, err)
+	defer w.Close()
+
+	r, err := g.Open("1234")
+	assert.NoError(t, err)
+
+	read := make(chan error)
+	go func() {
+		_, err := r.Read(make([]byte, 100))
+		read <- err
+	}()
+
+	time.Sleep(readThrottle)
+	assert.NoError(t, r.Close())
+	assert.Equal(t, io.ErrClosedPipe, <-read)
+
+	// The polling goroutine has stopped.
+	calls := f.Calls("GetLogEvents")
+	time.Sleep(2 * readThrottle)
+	assert.Equal(t, calls, f.Calls("GetLogEvents"))
+
+	assert.NoError(t, r.Close())
+}
+
+func TestReader_Fake(t *testing.T) {
+	f := cloudwatchtest.New()
+	f.Now = now
+
+	g, err := AttachGroup("group", f)
+	assert.NoError(t, err)
+	w, err := g.AttachStream("1234")
+	assert.NoError(t, err)
+
+	r := &Reader{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: f,
+		opts:   ReaderOptions{StartFromHead: true, Follow: true, Limiter: NewLimiter(nil)},
+	}
+
+	io.WriteString(w, "Hello\n")
+	assert.NoError(t, w.Flush())
+	assert.NoError(t, r.read(context.Background()))
+
+	io.WriteString(w, "World\n")
+	assert.NoError(t, w.Close())
+	assert.NoError(t, r.read(context.Background()))
+
+	// Reading again from the end of the stream doesn't repeat anything.
+	assert.NoError(t, r.read(context.Background()))
+
+	b := make([]byte, 100)
+	n, err := r.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello\nWorld\n", string(b[:n]))
+}
+
+func TestReader_Next(t *testing.T) {
+	c := new(mockClient)
+	r := &Reader{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: c,
+		opts:   ReaderOptions{StartFromHead: true, Follow: true, Limiter: NewLimiter(nil)},
+	}
+
+	c.On("GetLogEvents", &cloudwatchlogs.GetLogEventsInput{
+		LogGroupName:  aws.String("group"),
+		StartFromHead: aws.Bool(true),
+		LogStreamName: aws.String("1234"),
+	}).Once().Return(&cloudwatchlogs.GetLogEventsOutput{
+		Events: []*cloudwatchlogs.OutputLogEvent{
+			{Message: aws.String("Hello"), Timestamp: aws.Int64(1000), IngestionTime: aws.Int64(1500)},
+			{Message: aws.String("World"), Timestamp: aws.Int64(2000)},
+		},
+	}, nil)
+
+	assert.NoError(t, r.read(context.Background()))
+
+	event, err := r.Next(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, Event{
+		Timestamp:     time.Unix(1, 0),
+		IngestionTime: time.Unix(1, 5e8),
+		Message:       "Hello",
+		Stream:        "1234",
+	}, event)
+
+	event, err = r.Next(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, Event{
+		Timestamp: time.Unix(2, 0),
+		Message:   "World",
+		Stream:    "1234",
+	}, event)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = r.Next(ctx)
+	assert.Equal(t, context.Canceled, err)
+
+	c.AssertExpectations(t)
+}
+
+func TestReader_Options(t *testing.T) {
+	c := new(mockClient)
+	r := &Reader{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: c,
+		opts: ReaderOptions{
+			StartTime: time.Unix(1, 0),
+			EndTime:   time.Unix(2, 0),
+			Limiter:   NewLimiter(nil),
+		},
+	}
+
+	c.On("GetLogEvents", &cloudwatchlogs.GetLogEventsInput{
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+		StartFromHead: aws.Bool(false),
+		StartTime:     aws.Int64(1000),
+		EndTime:       aws.Int64(2000),
+	}).Once().Return(&cloudwatchlogs.GetLogEventsOutput{
+		Events: []*cloudwatchlogs.OutputLogEvent{
+			{Message: aws.String("Hello"), Timestamp: aws.Int64(1000)},
+		},
+		NextForwardToken: aws.String("next"),
+	}, nil)
+
+	c.On("GetLogEvents", &cloudwatchlogs.GetLogEventsInput{
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+		StartFromHead: aws.Bool(true),
+		StartTime:     aws.Int64(1000),
+		EndTime:       aws.Int64(2000),
+		NextToken:     aws.String("next"),
+	}).Once().Return(&cloudwatchlogs.GetLogEventsOutput{
+		Events:           []*cloudwatchlogs.OutputLogEvent{},
+		NextForwardToken: aws.String("next"),
+	}, nil)
+
+	assert.NoError(t, r.read(context.Background()))
+
+	// The forward token didn't advance, so that's the end of the stream.
+	assert.Equal(t, io.EOF, r.read(context.Background()))
+
+	c.AssertExpectations(t)
+}
+
+func TestReader_NoFollow(t *testing.T) {
+	f := cloudwatchtest.New()
+	f.Now = now
+
+	g, err := AttachGroup("group", f)
+	assert.NoError(t, err)
+	w, err := g.AttachStream("1234")
+	assert.NoError(t, err)
+
+	io.WriteString(w, "Hello\nWorld\n")
+	assert.NoError(t, w.Close())
+
+	r, err := g.OpenWithOptions("1234", ReaderOptions{StartFromHead: true})
+	assert.NoError(t, err)
+	defer r.Close()
+
+	// io.Copy returns once the whole stream has been read.
+	b := new(bytes.Buffer)
+	_, err = io.Copy(b, r)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello\nWorld\n", b.String())
+}
+
+func TestReader_Checkpoint(t *testing.T) {
+	c := new(mockClient)
+	checkpoints := NewMemoryCheckpointer()
+	checkpoints.Save("group", "1234", Checkpoint{
+		Token:     "saved",
+		Timestamp: time.Unix(1, 0),
+		Saved:     now(),
+	})
+
+	r := &Reader{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: c,
+		opts:   ReaderOptions{StartFromHead: true, Follow: true, Checkpointer: checkpoints, Limiter: NewLimiter(nil)},
+	}
+
+	c.On("GetLogEvents", &cloudwatchlogs.GetLogEventsInput{
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+		StartFromHead: aws.Bool(true),
+		NextToken:     aws.String("saved"),
+	}).Once().Return(&cloudwatchlogs.GetLogEventsOutput{
+		Events: []*cloudwatchlogs.OutputLogEvent{
+			{Message: aws.String("Hello"), Timestamp: aws.Int64(2000)},
+			{Message: aws.String("World"), Timestamp: aws.Int64(3000)},
+		},
+		NextForwardToken: aws.String("next"),
+	}, nil)
+
+	assert.NoError(t, r.resume())
+	assert.NoError(t, r.read(context.Background()))
+
+	// The checkpoint is saved once the last event of the page is returned.
+	_, err := r.Next(context.Background())
+	assert.NoError(t, err)
+	checkpoint, _ := checkpoints.Load("group", "1234")
+	assert.Equal(t, "saved", checkpoint.Token)
+
+	_, err = r.Next(context.Background())
+	assert.NoError(t, err)
+	checkpoint, _ = checkpoints.Load("group", "1234")
+	assert.Equal(t, &Checkpoint{
+		Token:     "next",
+		Timestamp: time.Unix(3, 0),
+		Saved:     now(),
+	}, checkpoint)
+
+	c.AssertExpectations(t)
+}
+
+func TestReader_CheckpointExpired(t *testing.T) {
+	c := new(mockClient)
+	checkpoints := NewMemoryCheckpointer()
+	checkpoints.Save("group", "1234", Checkpoint{
+		Token:     "expired",
+		Timestamp: time.Unix(5, 0),
+		Saved:     now().Add(-25 * time.Hour),
+	})
+
+	r := &Reader{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: c,
+		opts:   ReaderOptions{Follow: true, Checkpointer: checkpoints, Limiter: NewLimiter(nil)},
+	}
+
+	// The token has expired, so the Reader starts from the checkpoint's
+	// timestamp instead.
+	c.On("GetLogEvents", &cloudwatchlogs.GetLogEventsInput{
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+		StartFromHead: aws.Bool(true),
+		StartTime:     aws.Int64(5000),
+	}).Once().Return(&cloudwatchlogs.GetLogEventsOutput{
+		Events:           []*cloudwatchlogs.OutputLogEvent{},
+		NextForwardToken: aws.String("next"),
+	}, nil)
+
+	assert.NoError(t, r.resume())
+	assert.NoError(t, r.read(context.Background()))
+
+	// Nothing was buffered, so the new token is saved straight away.
+	checkpoint, _ := checkpoints.Load("group", "1234")
+	assert.Equal(t, &Checkpoint{
+		Token:     "next",
+		Timestamp: time.Unix(5, 0),
+		Saved:     now(),
+	}, checkpoint)
+
+	c.AssertExpectations(t)
+}
+
+func TestReader_Resume(t *testing.T) {
+	f := cloudwatchtest.New()
+	f.Now = now
+
+	g, err := AttachGroup("group", f)
+	assert.NoError(t, err)
+	w, err := g.AttachStream("1234")
+	assert.NoError(t, err)
+	defer w.Close()
+
+	checkpoints := NewMemoryCheckpointer()
+	opts := ReaderOptions{StartFromHead: true, Checkpointer: checkpoints}
+
+	io.WriteString(w, "Hello\n")
+	assert.NoError(t, w.Flush())
+
+	r, err := g.OpenWithOptions("1234", opts)
+	assert.NoError(t, err)
+	b := new(bytes.Buffer)
+	_, err = io.Copy(b, r)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello\n", b.String())
+	assert.NoError(t, r.Close())
+
+	io.WriteString(w, "World\n")
+	assert.NoError(t, w.Flush())
+
+	// A new Reader carries on from where the last one stopped.
+	r, err = g.OpenWithOptions("1234", opts)
+	assert.NoError(t, err)
+	defer r.Close()
+	b.Reset()
+	_, err = io.Copy(b, r)
+	assert.NoError(t, err)
+	assert.Equal(t, "World\n", b.String())
+}
+
+func TestReader_FilterPattern(t *testing.T) {
+	f := cloudwatchtest.New()
+	f.Now = now
+
+	g, err := AttachGroup("group", f)
+	assert.NoError(t, err)
+	w, err := g.AttachStream("1234")
+	assert.NoError(t, err)
+
+	io.WriteString(w, "ERROR one\nINFO two\nERROR three\n")
+	assert.NoError(t, w.Close())
+
+	r, err := g.OpenWithOptions("1234", ReaderOptions{
+		StartFromHead: true,
+		FilterPattern: "ERROR",
+	})
+	assert.NoError(t, err)
+	defer r.Close()
+
+	b := new(bytes.Buffer)
+	_, err = io.Copy(b, r)
+	assert.NoError(t, err)
+	assert.Equal(t, "ERROR one\nERROR three\n", b.String())
+
+	// Checkpoints can't be kept for filtered reads.
+	r, err = g.OpenWithOptions("1234", ReaderOptions{
+		FilterPattern: "ERROR",
+		Checkpointer:  NewMemoryCheckpointer(),
+	})
+	assert.NoError(t, err)
+	defer r.Close()
+	_, err = r.Read(make([]byte, 10))
+	assert.Equal(t, errCheckpointUnsupported, err)
+}
+
+func TestReader_Tail(t *testing.T) {
+	f := cloudwatchtest.New()
+	f.Now = now
+
+	g, err := AttachGroup("group", f)
+	assert.NoError(t, err)
+	w, err := g.AttachStream("1234")
+	assert.NoError(t, err)
+
+	io.WriteString(w, "Hello\n")
+	assert.NoError(t, w.Flush())
+
+	r := &Reader{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: f,
+		opts:   ReaderOptions{Follow: true, Limiter: NewLimiter(nil)},
+	}
+
+	// The first page is the end of the stream, and the next pages follow
+	// it with the forward token.
+	assert.NoError(t, r.read(context.Background()))
+	io.WriteString(w, "World\n")
+	assert.NoError(t, w.Close())
+	assert.NoError(t, r.read(context.Background()))
+
+	b := make([]byte, 100)
+	n, err := r.Read(b)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello\nWorld\n", string(b[:n]))
+}
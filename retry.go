@@ -0,0 +1,101 @@
+package cloudwatch
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+const throttlingCode = "ThrottlingException"
+
+// sleep pauses the current goroutine for d, or until ctx is done. It's a
+// variable so that it can be stubbed out in unit tests.
+var sleep = sleepContext
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RetryPolicy controls how a Writer retries a PutLogEvents request that
+// failed.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a request is attempted,
+	// including the first. Values less than 1 are treated as 1.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry. Each subsequent retry
+	// doubles the delay, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// Jitter is the fraction, between 0 and 1, of each delay that is
+	// randomized.
+	Jitter float64
+
+	// RetryableCodes lists the AWS error codes that are retried. If nil, the
+	// codes from DefaultRetryPolicy are used. Errors that don't carry an AWS
+	// error code, such as network errors, are always retried.
+	RetryableCodes []string
+}
+
+// DefaultRetryPolicy is the RetryPolicy used when WriterOptions doesn't
+// specify one.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   200 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+	Jitter:      0.5,
+	RetryableCodes: []string{
+		throttlingCode,
+		cloudwatchlogs.ErrCodeServiceUnavailableException,
+		request.ErrCodeRequestError,
+	},
+}
+
+// retryable returns true if err should be retried.
+func (p *RetryPolicy) retryable(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return true
+	}
+
+	codes := p.RetryableCodes
+	if codes == nil {
+		codes = DefaultRetryPolicy.RetryableCodes
+	}
+	for _, code := range codes {
+		if awsErr.Code() == code {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns how long to wait before the given retry. The first retry is
+// 1.
+func (p *RetryPolicy) delay(retry int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < retry && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	if p.Jitter > 0 {
+		d -= time.Duration(p.Jitter * rand.Float64() * float64(d))
+	}
+	return d
+}
@@ -0,0 +1,37 @@
+package cloudwatch
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	p := &RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	assert.Equal(t, time.Second, p.delay(1))
+	assert.Equal(t, 2*time.Second, p.delay(2))
+	assert.Equal(t, 4*time.Second, p.delay(3))
+	assert.Equal(t, 5*time.Second, p.delay(4))
+	assert.Equal(t, 5*time.Second, p.delay(100))
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := p.delay(1)
+		assert.True(t, d > time.Second/2 && d <= time.Second)
+	}
+}
+
+func TestRetryPolicy_Retryable(t *testing.T) {
+	p := &RetryPolicy{}
+	assert.True(t, p.retryable(errors.New("connection reset")))
+	assert.True(t, p.retryable(awserr.New(throttlingCode, "slow down", nil)))
+	assert.False(t, p.retryable(awserr.New("AccessDeniedException", "no", nil)))
+
+	p.RetryableCodes = []string{"AccessDeniedException"}
+	assert.True(t, p.retryable(awserr.New("AccessDeniedException", "no", nil)))
+	assert.False(t, p.retryable(awserr.New(throttlingCode, "slow down", nil)))
+}
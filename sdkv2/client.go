@@ -0,0 +1,273 @@
+// Package sdkv2 adapts a CloudWatch Logs client from aws-sdk-go-v2, so that
+// it can be used with the cloudwatch package:
+//
+//	cfg, err := config.LoadDefaultConfig(ctx)
+//	...
+//	g, err := cloudwatch.AttachGroup("group", sdkv2.NewClient(cloudwatchlogs.NewFromConfig(cfg)))
+package sdkv2
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/eltorocorp/cloudwatch"
+
+	cwl "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/smithy-go"
+)
+
+// API is the subset of *cloudwatchlogs.Client from aws-sdk-go-v2 that the
+// adapter uses.
+type API interface {
+	PutLogEvents(context.Context, *cwl.PutLogEventsInput, ...func(*cwl.Options)) (*cwl.PutLogEventsOutput, error)
+	GetLogEvents(context.Context, *cwl.GetLogEventsInput, ...func(*cwl.Options)) (*cwl.GetLogEventsOutput, error)
+	FilterLogEvents(context.Context, *cwl.FilterLogEventsInput, ...func(*cwl.Options)) (*cwl.FilterLogEventsOutput, error)
+	CreateLogGroup(context.Context, *cwl.CreateLogGroupInput, ...func(*cwl.Options)) (*cwl.CreateLogGroupOutput, error)
+	CreateLogStream(context.Context, *cwl.CreateLogStreamInput, ...func(*cwl.Options)) (*cwl.CreateLogStreamOutput, error)
+	DescribeLogGroups(context.Context, *cwl.DescribeLogGroupsInput, ...func(*cwl.Options)) (*cwl.DescribeLogGroupsOutput, error)
+	DescribeLogStreams(context.Context, *cwl.DescribeLogStreamsInput, ...func(*cwl.Options)) (*cwl.DescribeLogStreamsOutput, error)
+}
+
+var _ API = (*cwl.Client)(nil)
+
+// client implements cloudwatch.Client by converting requests and responses
+// between the two SDKs' types.
+type client struct {
+	api API
+}
+
+// NewClient returns a cloudwatch.Client that sends its requests with api.
+//
+// Contexts are passed through to api. Errors returned by the service are
+// converted to awserr.Errors with the same code, so that the cloudwatch
+// package handles them the same way as errors from aws-sdk-go. Any
+// request.Options are ignored.
+func NewClient(api API) cloudwatch.Client {
+	return &client{api: api}
+}
+
+func (c *client) PutLogEventsWithContext(ctx aws.Context, input *cloudwatchlogs.PutLogEventsInput, _ ...request.Option) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	events := make([]types.InputLogEvent, len(input.LogEvents))
+	for i, event := range input.LogEvents {
+		events[i] = types.InputLogEvent{
+			Message:   event.Message,
+			Timestamp: event.Timestamp,
+		}
+	}
+
+	resp, err := c.api.PutLogEvents(ctx, &cwl.PutLogEventsInput{
+		LogEvents:     events,
+		LogGroupName:  input.LogGroupName,
+		LogStreamName: input.LogStreamName,
+		SequenceToken: input.SequenceToken,
+	})
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	out := &cloudwatchlogs.PutLogEventsOutput{
+		NextSequenceToken: resp.NextSequenceToken,
+	}
+	if info := resp.RejectedLogEventsInfo; info != nil {
+		out.RejectedLogEventsInfo = &cloudwatchlogs.RejectedLogEventsInfo{
+			ExpiredLogEventEndIndex:  int64Ptr(info.ExpiredLogEventEndIndex),
+			TooNewLogEventStartIndex: int64Ptr(info.TooNewLogEventStartIndex),
+			TooOldLogEventEndIndex:   int64Ptr(info.TooOldLogEventEndIndex),
+		}
+	}
+	return out, nil
+}
+
+func (c *client) GetLogEventsWithContext(ctx aws.Context, input *cloudwatchlogs.GetLogEventsInput, _ ...request.Option) (*cloudwatchlogs.GetLogEventsOutput, error) {
+	resp, err := c.api.GetLogEvents(ctx, &cwl.GetLogEventsInput{
+		EndTime:       input.EndTime,
+		Limit:         int32Ptr(input.Limit),
+		LogGroupName:  input.LogGroupName,
+		LogStreamName: input.LogStreamName,
+		NextToken:     input.NextToken,
+		StartFromHead: input.StartFromHead,
+		StartTime:     input.StartTime,
+	})
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	out := &cloudwatchlogs.GetLogEventsOutput{
+		NextBackwardToken: resp.NextBackwardToken,
+		NextForwardToken:  resp.NextForwardToken,
+	}
+	for _, event := range resp.Events {
+		out.Events = append(out.Events, &cloudwatchlogs.OutputLogEvent{
+			IngestionTime: event.IngestionTime,
+			Message:       event.Message,
+			Timestamp:     event.Timestamp,
+		})
+	}
+	return out, nil
+}
+
+func (c *client) FilterLogEventsWithContext(ctx aws.Context, input *cloudwatchlogs.FilterLogEventsInput, _ ...request.Option) (*cloudwatchlogs.FilterLogEventsOutput, error) {
+	resp, err := c.api.FilterLogEvents(ctx, &cwl.FilterLogEventsInput{
+		EndTime:             input.EndTime,
+		FilterPattern:       input.FilterPattern,
+		Interleaved:         input.Interleaved,
+		Limit:               int32Ptr(input.Limit),
+		LogGroupName:        input.LogGroupName,
+		LogStreamNamePrefix: input.LogStreamNamePrefix,
+		LogStreamNames:      aws.StringValueSlice(input.LogStreamNames),
+		NextToken:           input.NextToken,
+		StartTime:           input.StartTime,
+	})
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	out := &cloudwatchlogs.FilterLogEventsOutput{
+		NextToken: resp.NextToken,
+	}
+	for _, event := range resp.Events {
+		out.Events = append(out.Events, &cloudwatchlogs.FilteredLogEvent{
+			EventId:       event.EventId,
+			IngestionTime: event.IngestionTime,
+			LogStreamName: event.LogStreamName,
+			Message:       event.Message,
+			Timestamp:     event.Timestamp,
+		})
+	}
+	for _, stream := range resp.SearchedLogStreams {
+		out.SearchedLogStreams = append(out.SearchedLogStreams, &cloudwatchlogs.SearchedLogStream{
+			LogStreamName:      stream.LogStreamName,
+			SearchedCompletely: stream.SearchedCompletely,
+		})
+	}
+	return out, nil
+}
+
+func (c *client) CreateLogGroupWithContext(ctx aws.Context, input *cloudwatchlogs.CreateLogGroupInput, _ ...request.Option) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+	_, err := c.api.CreateLogGroup(ctx, &cwl.CreateLogGroupInput{
+		KmsKeyId:     input.KmsKeyId,
+		LogGroupName: input.LogGroupName,
+		Tags:         aws.StringValueMap(input.Tags),
+	})
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return &cloudwatchlogs.CreateLogGroupOutput{}, nil
+}
+
+func (c *client) CreateLogStreamWithContext(ctx aws.Context, input *cloudwatchlogs.CreateLogStreamInput, _ ...request.Option) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+	_, err := c.api.CreateLogStream(ctx, &cwl.CreateLogStreamInput{
+		LogGroupName:  input.LogGroupName,
+		LogStreamName: input.LogStreamName,
+	})
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return &cloudwatchlogs.CreateLogStreamOutput{}, nil
+}
+
+func (c *client) DescribeLogGroupsWithContext(ctx aws.Context, input *cloudwatchlogs.DescribeLogGroupsInput, _ ...request.Option) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+	resp, err := c.api.DescribeLogGroups(ctx, &cwl.DescribeLogGroupsInput{
+		Limit:              int32Ptr(input.Limit),
+		LogGroupNamePrefix: input.LogGroupNamePrefix,
+		NextToken:          input.NextToken,
+	})
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	out := &cloudwatchlogs.DescribeLogGroupsOutput{
+		NextToken: resp.NextToken,
+	}
+	for _, group := range resp.LogGroups {
+		out.LogGroups = append(out.LogGroups, &cloudwatchlogs.LogGroup{
+			Arn:               group.Arn,
+			CreationTime:      group.CreationTime,
+			LogGroupName:      group.LogGroupName,
+			MetricFilterCount: int64Ptr(group.MetricFilterCount),
+			RetentionInDays:   int64Ptr(group.RetentionInDays),
+			StoredBytes:       group.StoredBytes,
+		})
+	}
+	return out, nil
+}
+
+func (c *client) DescribeLogStreamsWithContext(ctx aws.Context, input *cloudwatchlogs.DescribeLogStreamsInput, _ ...request.Option) (*cloudwatchlogs.DescribeLogStreamsOutput, error) {
+	resp, err := c.api.DescribeLogStreams(ctx, &cwl.DescribeLogStreamsInput{
+		Descending:          input.Descending,
+		Limit:               int32Ptr(input.Limit),
+		LogGroupName:        input.LogGroupName,
+		LogStreamNamePrefix: input.LogStreamNamePrefix,
+		NextToken:           input.NextToken,
+		OrderBy:             types.OrderBy(aws.StringValue(input.OrderBy)),
+	})
+	if err != nil {
+		return nil, convertError(err)
+	}
+
+	out := &cloudwatchlogs.DescribeLogStreamsOutput{
+		NextToken: resp.NextToken,
+	}
+	for _, stream := range resp.LogStreams {
+		out.LogStreams = append(out.LogStreams, &cloudwatchlogs.LogStream{
+			Arn:                 stream.Arn,
+			CreationTime:        stream.CreationTime,
+			FirstEventTimestamp: stream.FirstEventTimestamp,
+			LastEventTimestamp:  stream.LastEventTimestamp,
+			LastIngestionTime:   stream.LastIngestionTime,
+			LogStreamName:       stream.LogStreamName,
+			StoredBytes:         stream.StoredBytes,
+			UploadSequenceToken: stream.UploadSequenceToken,
+		})
+	}
+	return out, nil
+}
+
+// convertError converts an error returned by the service to an awserr.Error.
+// Other errors, such as network errors and cancelled contexts, are returned
+// as they are.
+func convertError(err error) error {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+
+	// The cloudwatch package reads the expected sequence token from the end
+	// of the message, as aws-sdk-go doesn't expose it any other way.
+	message := apiErr.ErrorMessage()
+	var expected *string
+	var invalidToken *types.InvalidSequenceTokenException
+	var alreadyAccepted *types.DataAlreadyAcceptedException
+	if errors.As(err, &invalidToken) {
+		expected = invalidToken.ExpectedSequenceToken
+	} else if errors.As(err, &alreadyAccepted) {
+		expected = alreadyAccepted.ExpectedSequenceToken
+	}
+	if expected != nil && !strings.HasSuffix(message, " "+*expected) {
+		message += " The next expected sequenceToken is: " + *expected
+	}
+
+	return awserr.New(apiErr.ErrorCode(), message, err)
+}
+
+func int32Ptr(v *int64) *int32 {
+	if v == nil {
+		return nil
+	}
+	i := int32(*v)
+	return &i
+}
+
+func int64Ptr(v *int32) *int64 {
+	if v == nil {
+		return nil
+	}
+	i := int64(*v)
+	return &i
+}
@@ -0,0 +1,184 @@
+package sdkv2
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/eltorocorp/cloudwatch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	cwl "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+type mockAPI struct {
+	mock.Mock
+	API
+}
+
+func (m *mockAPI) PutLogEvents(ctx context.Context, input *cwl.PutLogEventsInput, _ ...func(*cwl.Options)) (*cwl.PutLogEventsOutput, error) {
+	args := m.Called(ctx, input)
+	out, _ := args.Get(0).(*cwl.PutLogEventsOutput)
+	return out, args.Error(1)
+}
+
+func (m *mockAPI) GetLogEvents(ctx context.Context, input *cwl.GetLogEventsInput, _ ...func(*cwl.Options)) (*cwl.GetLogEventsOutput, error) {
+	args := m.Called(ctx, input)
+	out, _ := args.Get(0).(*cwl.GetLogEventsOutput)
+	return out, args.Error(1)
+}
+
+func (m *mockAPI) CreateLogStream(ctx context.Context, input *cwl.CreateLogStreamInput, _ ...func(*cwl.Options)) (*cwl.CreateLogStreamOutput, error) {
+	args := m.Called(ctx, input)
+	out, _ := args.Get(0).(*cwl.CreateLogStreamOutput)
+	return out, args.Error(1)
+}
+
+type contextKey struct{}
+
+func TestClient_PutLogEvents(t *testing.T) {
+	m := new(mockAPI)
+	c := NewClient(m)
+
+	ctx := context.WithValue(context.Background(), contextKey{}, "value")
+
+	m.On("PutLogEvents", ctx, &cwl.PutLogEventsInput{
+		LogEvents: []types.InputLogEvent{
+			{Message: aws.String("Hello"), Timestamp: aws.Int64(1000)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+		SequenceToken: aws.String("abcd"),
+	}).Return(&cwl.PutLogEventsOutput{
+		NextSequenceToken: aws.String("efgh"),
+		RejectedLogEventsInfo: &types.RejectedLogEventsInfo{
+			TooOldLogEventEndIndex: new(int32),
+		},
+	}, nil)
+
+	resp, err := c.PutLogEventsWithContext(ctx, &cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("Hello"), Timestamp: aws.Int64(1000)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+		SequenceToken: aws.String("abcd"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &cloudwatchlogs.PutLogEventsOutput{
+		NextSequenceToken: aws.String("efgh"),
+		RejectedLogEventsInfo: &cloudwatchlogs.RejectedLogEventsInfo{
+			TooOldLogEventEndIndex: aws.Int64(0),
+		},
+	}, resp)
+
+	m.AssertExpectations(t)
+}
+
+func TestClient_GetLogEvents(t *testing.T) {
+	m := new(mockAPI)
+	c := NewClient(m)
+
+	limit := int32(10)
+	m.On("GetLogEvents", mock.Anything, &cwl.GetLogEventsInput{
+		Limit:         &limit,
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+		StartFromHead: aws.Bool(true),
+	}).Return(&cwl.GetLogEventsOutput{
+		Events: []types.OutputLogEvent{
+			{Message: aws.String("Hello"), Timestamp: aws.Int64(1000), IngestionTime: aws.Int64(2000)},
+		},
+		NextForwardToken: aws.String("f/1"),
+	}, nil)
+
+	resp, err := c.GetLogEventsWithContext(context.Background(), &cloudwatchlogs.GetLogEventsInput{
+		Limit:         aws.Int64(10),
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+		StartFromHead: aws.Bool(true),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &cloudwatchlogs.GetLogEventsOutput{
+		Events: []*cloudwatchlogs.OutputLogEvent{
+			{Message: aws.String("Hello"), Timestamp: aws.Int64(1000), IngestionTime: aws.Int64(2000)},
+		},
+		NextForwardToken: aws.String("f/1"),
+	}, resp)
+
+	m.AssertExpectations(t)
+}
+
+func TestConvertError(t *testing.T) {
+	err := convertError(&types.InvalidSequenceTokenException{
+		Message:               aws.String("The given sequenceToken is invalid."),
+		ExpectedSequenceToken: aws.String("abcd"),
+	})
+	if awsErr, ok := err.(awserr.Error); assert.True(t, ok) {
+		assert.Equal(t, cloudwatchlogs.ErrCodeInvalidSequenceTokenException, awsErr.Code())
+		assert.Equal(t, "The given sequenceToken is invalid. The next expected sequenceToken is: abcd", awsErr.Message())
+	}
+
+	err = convertError(&types.DataAlreadyAcceptedException{
+		Message:               aws.String("The given batch of log events has already been accepted. The next batch can be sent with sequenceToken: abcd"),
+		ExpectedSequenceToken: aws.String("abcd"),
+	})
+	if awsErr, ok := err.(awserr.Error); assert.True(t, ok) {
+		assert.Equal(t, "The given batch of log events has already been accepted. The next batch can be sent with sequenceToken: abcd", awsErr.Message())
+	}
+
+	// Errors that didn't come from the service are left alone.
+	assert.Equal(t, context.Canceled, convertError(context.Canceled))
+}
+
+func TestWriter(t *testing.T) {
+	m := new(mockAPI)
+
+	m.On("CreateLogStream", mock.Anything, &cwl.CreateLogStreamInput{
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	}).Return(&cwl.CreateLogStreamOutput{}, nil)
+
+	m.On("PutLogEvents", mock.Anything, mock.MatchedBy(func(input *cwl.PutLogEventsInput) bool {
+		return input.SequenceToken == nil
+	})).Return(nil, &types.InvalidSequenceTokenException{
+		Message:               aws.String("The given sequenceToken is invalid."),
+		ExpectedSequenceToken: aws.String("abcd"),
+	})
+
+	m.On("PutLogEvents", mock.Anything, mock.MatchedBy(func(input *cwl.PutLogEventsInput) bool {
+		return aws.StringValue(input.SequenceToken) == "abcd" &&
+			len(input.LogEvents) == 1 && *input.LogEvents[0].Message == "Hello\n"
+	})).Return(&cwl.PutLogEventsOutput{NextSequenceToken: aws.String("efgh")}, nil)
+
+	g, err := cloudwatch.NewGroup("group", NewClient(m))
+	assert.NoError(t, err)
+
+	w, err := g.AttachStreamWithOptions("1234", cloudwatch.WriterOptions{
+		RetryPolicy: &cloudwatch.RetryPolicy{MaxAttempts: 2},
+	})
+	assert.NoError(t, err)
+
+	_, err = io.WriteString(w, "Hello\n")
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	m.AssertExpectations(t)
+}
+
+func TestClient_NotAPIError(t *testing.T) {
+	m := new(mockAPI)
+	c := NewClient(m)
+
+	failure := errors.New("connection reset")
+	m.On("GetLogEvents", mock.Anything, mock.Anything).Return(nil, failure)
+
+	_, err := c.GetLogEventsWithContext(context.Background(), &cloudwatchlogs.GetLogEventsInput{})
+	assert.Equal(t, failure, err)
+}
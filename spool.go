@@ -0,0 +1,433 @@
+package cloudwatch
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// ErrSpoolFull is passed to WriterOptions.OnDropped for events that were
+// discarded because the spool reached SpoolOptions.MaxBytes.
+var ErrSpoolFull = errors.New("cloudwatch: spool is full")
+
+const (
+	segmentExt = ".seg"
+
+	// badSegmentExt is given to segments that can't be read, so that they
+	// are kept for inspection but not sent.
+	badSegmentExt = ".bad"
+)
+
+// SpoolDropPolicy determines which events are discarded when a spool is full.
+type SpoolDropPolicy int
+
+const (
+	// SpoolDropOldest deletes the oldest segments to make room for new
+	// events. This is the default.
+	SpoolDropOldest SpoolDropPolicy = iota
+
+	// SpoolDropNewest discards new events until there is room for them.
+	SpoolDropNewest
+)
+
+// SpoolOptions configures an on-disk spool. When a Writer has a spool, events
+// are appended to segment files in Dir before Write returns, and segments are
+// only deleted once they have been sent to CloudWatch Logs. Segments left
+// behind by a previous process are sent when the Writer starts.
+type SpoolOptions struct {
+	// Dir is the directory that segment files are written to. It is created
+	// if it doesn't exist. A Dir should only be used by one Writer at a time.
+	Dir string
+
+	// MaxSegmentBytes is the size at which a segment is sealed and a new one
+	// started. Defaults to the maximum size of a PutLogEvents request.
+	MaxSegmentBytes int64
+
+	// MaxBytes caps the total size of the segments in Dir. Zero means there
+	// is no limit. The segment being sent isn't dropped to make room, so the
+	// cap can be exceeded by up to a segment while a flush is in progress.
+	MaxBytes int64
+
+	// Drop determines what is discarded when MaxBytes is reached.
+	Drop SpoolDropPolicy
+
+	// Sync calls fsync after each append, at the cost of throughput.
+	Sync bool
+}
+
+// spooledEvent is how a log event is encoded in a segment file, one per line.
+type spooledEvent struct {
+	Timestamp int64  `json:"t"`
+	Message   string `json:"m"`
+}
+
+type segment struct {
+	path string
+	size int64
+}
+
+// spool is a directory of segment files that act as a write-ahead log for a
+// Writer. Events are appended to the last, active, segment. All other
+// segments are sealed and waiting to be sent.
+type spool struct {
+	opts SpoolOptions
+
+	// onDrop is called with events discarded to stay within MaxBytes.
+	onDrop func([]*cloudwatchlogs.InputLogEvent, error)
+
+	sync.Mutex
+	segments []*segment
+	active   *os.File
+	size     int64
+	next     uint64
+
+	// unsent is the number of bytes appended since sealed was last called.
+	unsent int64
+
+	// sending is the segment being sent, which isn't dropped to make room.
+	sending *segment
+}
+
+func openSpool(opts SpoolOptions, onDrop func([]*cloudwatchlogs.InputLogEvent, error)) (*spool, error) {
+	if opts.MaxSegmentBytes <= 0 {
+		opts.MaxSegmentBytes = maximumBytesPerPut
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &spool{opts: opts, onDrop: onDrop}
+
+	// Segment names are zero padded sequence numbers, so sorting them by name
+	// sorts them in the order they were written.
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+
+		var seq uint64
+		if _, err := fmt.Sscanf(name, "%d"+segmentExt, &seq); err != nil {
+			continue
+		}
+		if seq >= s.next {
+			s.next = seq + 1
+		}
+
+		s.segments = append(s.segments, &segment{
+			path: filepath.Join(opts.Dir, name),
+			size: f.Size(),
+		})
+		s.size += f.Size()
+	}
+
+	return s, nil
+}
+
+// append writes events to the active segment, starting a new one if needed.
+func (s *spool) append(events []*cloudwatchlogs.InputLogEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	var buf strings.Builder
+	enc := json.NewEncoder(&buf)
+	for _, event := range events {
+		if err := enc.Encode(spooledEvent{*event.Timestamp, *event.Message}); err != nil {
+			return err
+		}
+	}
+	data := buf.String()
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.opts.MaxBytes > 0 {
+		for s.size+int64(len(data)) > s.opts.MaxBytes {
+			if s.opts.Drop == SpoolDropNewest || !s.dropOldest() {
+				break
+			}
+		}
+
+		if s.opts.Drop == SpoolDropNewest && s.size+int64(len(data)) > s.opts.MaxBytes {
+			s.drop(events)
+			return nil
+		}
+	}
+
+	if s.active == nil {
+		path := filepath.Join(s.opts.Dir, fmt.Sprintf("%020d%s", s.next, segmentExt))
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		s.next++
+		s.active = f
+		s.segments = append(s.segments, &segment{path: path})
+	}
+
+	n, err := s.active.WriteString(data)
+	s.size += int64(n)
+	s.unsent += int64(n)
+	active := s.segments[len(s.segments)-1]
+	active.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	if s.opts.Sync {
+		if err := s.active.Sync(); err != nil {
+			return err
+		}
+	}
+
+	if active.size >= s.opts.MaxSegmentBytes {
+		return s.sealLocked()
+	}
+	return nil
+}
+
+// dropOldest deletes the oldest segment that isn't being sent, sealing it
+// first if it is active. It returns false if there's no segment to delete.
+func (s *spool) dropOldest() bool {
+	var seg *segment
+	for _, other := range s.segments {
+		if other != s.sending {
+			seg = other
+			break
+		}
+	}
+	if seg == nil {
+		return false
+	}
+	if s.active != nil && seg == s.segments[len(s.segments)-1] {
+		s.sealLocked()
+	}
+
+	events, err := readSegment(seg.path)
+	if err != nil {
+		FallbackLogger.Errorln("error reading spool segment", seg.path, err)
+	}
+	if err := s.removeLocked(seg); err != nil {
+		FallbackLogger.Errorln("error removing spool segment", seg.path, err)
+		// Forget about the segment anyway, so that we don't loop forever.
+		for i, other := range s.segments {
+			if other == seg {
+				s.segments = append(s.segments[:i], s.segments[i+1:]...)
+				s.size -= seg.size
+				break
+			}
+		}
+	}
+	s.drop(events)
+	return true
+}
+
+func (s *spool) drop(events []*cloudwatchlogs.InputLogEvent) {
+	if s.onDrop != nil && len(events) > 0 {
+		s.onDrop(events, ErrSpoolFull)
+	}
+}
+
+// seal closes the active segment, so that it can be sent.
+func (s *spool) seal() error {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.sealLocked()
+}
+
+func (s *spool) sealLocked() error {
+	if s.active == nil {
+		return nil
+	}
+
+	err := s.active.Close()
+	s.active = nil
+	return err
+}
+
+// sealed returns the segments that are waiting to be sent, oldest first.
+func (s *spool) sealed() []*segment {
+	s.Lock()
+	defer s.Unlock()
+
+	s.unsent = 0
+
+	segments := s.segments
+	if s.active != nil {
+		segments = segments[:len(segments)-1]
+	}
+	return append([]*segment(nil), segments...)
+}
+
+// send marks seg as being sent, or no segment if seg is nil.
+func (s *spool) send(seg *segment) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.sending = seg
+}
+
+// unsentBytes returns the number of bytes appended since sealed was last
+// called.
+func (s *spool) unsentBytes() int64 {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.unsent
+}
+
+// remove deletes a segment that has been sent.
+func (s *spool) remove(seg *segment) error {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.removeLocked(seg)
+}
+
+func (s *spool) removeLocked(seg *segment) error {
+	if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for i, other := range s.segments {
+		if other == seg {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			s.size -= seg.size
+			break
+		}
+	}
+	return nil
+}
+
+// setAside renames a segment that can't be read, so that it no longer holds
+// up the segments after it. It is forgotten even if it can't be renamed.
+func (s *spool) setAside(seg *segment) error {
+	s.Lock()
+	defer s.Unlock()
+
+	err := os.Rename(seg.path, seg.path+badSegmentExt)
+	for i, other := range s.segments {
+		if other == seg {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			s.size -= seg.size
+			break
+		}
+	}
+	return err
+}
+
+// rewrite replaces the contents of a sealed segment with events, which is
+// used when only some of a segment was sent.
+func (s *spool) rewrite(seg *segment, events []*cloudwatchlogs.InputLogEvent) error {
+	tmp := seg.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, event := range events {
+		if err = enc.Encode(spooledEvent{*event.Timestamp, *event.Message}); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	info, err := os.Stat(tmp)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	// The segment may have been removed while it was being sent, in which
+	// case it mustn't be brought back.
+	for _, other := range s.segments {
+		if other == seg {
+			if err := os.Rename(tmp, seg.path); err != nil {
+				return err
+			}
+			s.size += info.Size() - seg.size
+			seg.size = info.Size()
+			return nil
+		}
+	}
+	return os.Remove(tmp)
+}
+
+// close closes the active segment. Any segments that haven't been sent are
+// left in the directory to be sent by the next Writer that uses it.
+func (s *spool) close() error {
+	return s.seal()
+}
+
+// readSegment reads the events in a segment file. A partially written last
+// line, left behind by a crash, is ignored.
+func readSegment(path string) ([]*cloudwatchlogs.InputLogEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []*cloudwatchlogs.InputLogEvent
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// Anything without a trailing newline was never fully written.
+			break
+		}
+		if err != nil {
+			return events, err
+		}
+
+		var e spooledEvent
+		if err := json.Unmarshal(line, &e); err != nil {
+			FallbackLogger.Errorln("skipping corrupt spool entry in", path, err)
+			continue
+		}
+
+		events = append(events, &cloudwatchlogs.InputLogEvent{
+			Message:   aws.String(e.Message),
+			Timestamp: aws.Int64(e.Timestamp),
+		})
+	}
+
+	return events, nil
+}
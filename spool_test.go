@@ -0,0 +1,236 @@
+package cloudwatch
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func tempSpool(t *testing.T, opts SpoolOptions) (*spool, func()) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Dir = dir
+
+	s, err := openSpool(opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, func() { os.RemoveAll(dir) }
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestWriter_Spool(t *testing.T) {
+	s, cleanup := tempSpool(t, SpoolOptions{})
+	defer cleanup()
+
+	c := new(mockClient)
+	w := &Writer{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: c,
+		core:   newStreamCore(),
+		spool:  s,
+	}
+
+	c.On("PutLogEvents", &cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("Hello\n"), Timestamp: aws.Int64(1000)},
+			{Message: aws.String("World"), Timestamp: aws.Int64(1000)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	}).Return(&cloudwatchlogs.PutLogEventsOutput{}, nil)
+
+	_, err := io.WriteString(w, "Hello\nWorld")
+	assert.NoError(t, err)
+
+	// The events are on disk before they are sent.
+	assert.Equal(t, 1, len(segmentFiles(t, s.opts.Dir)))
+
+	w.Flush()
+	assert.Empty(t, segmentFiles(t, s.opts.Dir))
+
+	c.AssertExpectations(t)
+}
+
+func TestWriter_SpoolReplay(t *testing.T) {
+	previous, cleanup := tempSpool(t, SpoolOptions{})
+	defer cleanup()
+
+	err := previous.append([]*cloudwatchlogs.InputLogEvent{
+		{Message: aws.String("Hello\n"), Timestamp: aws.Int64(1000)},
+	})
+	assert.NoError(t, err)
+
+	// Simulate a crash part way through writing an event.
+	f, err := os.OpenFile(previous.segments[0].path, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.NoError(t, err)
+	_, err = f.WriteString(`{"t":1000,"m":"Wor`)
+	assert.NoError(t, err)
+	f.Close()
+
+	s, err := openSpool(previous.opts, nil)
+	assert.NoError(t, err)
+
+	c := new(mockClient)
+	w := &Writer{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: c,
+		core:   newStreamCore(),
+		spool:  s,
+	}
+
+	c.On("PutLogEvents", &cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("Hello\n"), Timestamp: aws.Int64(1000)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	}).Return(&cloudwatchlogs.PutLogEventsOutput{}, nil)
+
+	w.Flush()
+	assert.Empty(t, segmentFiles(t, s.opts.Dir))
+
+	c.AssertExpectations(t)
+}
+
+func TestWriter_SpoolRetained(t *testing.T) {
+	s, cleanup := tempSpool(t, SpoolOptions{})
+	defer cleanup()
+
+	c := new(mockClient)
+	w := &Writer{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: c,
+		core:   newStreamCore(),
+		spool:  s,
+		opts: WriterOptions{
+			RetryPolicy: &RetryPolicy{MaxAttempts: 1},
+		},
+	}
+
+	c.On("PutLogEvents", mock.Anything).Once().Return(&cloudwatchlogs.PutLogEventsOutput{},
+		awserr.New(cloudwatchlogs.ErrCodeServiceUnavailableException, "unavailable", nil))
+	c.On("PutLogEvents", mock.Anything).Once().Return(&cloudwatchlogs.PutLogEventsOutput{}, nil)
+
+	io.WriteString(w, "Hello\n")
+
+	w.Flush()
+	assert.Equal(t, 1, len(segmentFiles(t, s.opts.Dir)))
+
+	w.Flush()
+	assert.Empty(t, segmentFiles(t, s.opts.Dir))
+
+	c.AssertExpectations(t)
+}
+
+func TestWriter_SpoolBadSegment(t *testing.T) {
+	s, cleanup := tempSpool(t, SpoolOptions{MaxSegmentBytes: 1})
+	defer cleanup()
+
+	c := new(mockClient)
+	w := &Writer{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: c,
+		core:   newStreamCore(),
+		spool:  s,
+	}
+
+	c.On("PutLogEvents", &cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("World\n"), Timestamp: aws.Int64(1000)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	}).Return(&cloudwatchlogs.PutLogEventsOutput{}, nil)
+
+	io.WriteString(w, "Hello\n")
+	io.WriteString(w, "World\n")
+
+	// Make the oldest segment unreadable.
+	bad := s.segments[0].path
+	assert.NoError(t, os.Remove(bad))
+	assert.NoError(t, os.Mkdir(bad, 0755))
+
+	// It's set aside, and the segments after it are still sent.
+	assert.Error(t, w.Flush())
+	assert.Empty(t, segmentFiles(t, s.opts.Dir))
+	_, err := os.Stat(bad + badSegmentExt)
+	assert.NoError(t, err)
+
+	c.AssertExpectations(t)
+}
+
+func TestSpool_MaxBytes(t *testing.T) {
+	var dropped []*cloudwatchlogs.InputLogEvent
+
+	s, cleanup := tempSpool(t, SpoolOptions{MaxBytes: 50, MaxSegmentBytes: 1})
+	defer cleanup()
+	s.onDrop = func(events []*cloudwatchlogs.InputLogEvent, err error) {
+		assert.Equal(t, ErrSpoolFull, err)
+		dropped = append(dropped, events...)
+	}
+
+	for _, message := range []string{"first", "second", "third"} {
+		err := s.append([]*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String(message), Timestamp: aws.Int64(1000)},
+		})
+		assert.NoError(t, err)
+	}
+
+	if assert.Equal(t, 1, len(dropped)) {
+		assert.Equal(t, "first", *dropped[0].Message)
+	}
+	assert.Equal(t, 2, len(segmentFiles(t, s.opts.Dir)))
+
+	s.opts.Drop = SpoolDropNewest
+	dropped = nil
+	err := s.append([]*cloudwatchlogs.InputLogEvent{
+		{Message: aws.String("fourth"), Timestamp: aws.Int64(1000)},
+	})
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(dropped)) {
+		assert.Equal(t, "fourth", *dropped[0].Message)
+	}
+	assert.Equal(t, 2, len(segmentFiles(t, s.opts.Dir)))
+
+	// The segment being sent isn't dropped to make room, even if it's the
+	// oldest.
+	s.opts.Drop = SpoolDropOldest
+	dropped = nil
+	s.send(s.sealed()[0])
+	for _, message := range []string{"fifth", "sixth"} {
+		err := s.append([]*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String(message), Timestamp: aws.Int64(1000)},
+		})
+		assert.NoError(t, err)
+	}
+	var messages []string
+	for _, event := range dropped {
+		messages = append(messages, *event.Message)
+	}
+	assert.Equal(t, []string{"third", "fifth"}, messages)
+	if assert.Equal(t, 2, len(s.segments)) {
+		assert.True(t, s.segments[0] == s.sending)
+	}
+}
@@ -0,0 +1,111 @@
+package cloudwatch
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimestampParser extracts the time of an event from a line written to a
+// Writer. If the line has a timestamp, it returns the time, the line with the
+// timestamp removed, and true.
+type TimestampParser func(line string) (t time.Time, rest string, ok bool)
+
+// ParseLayout returns a TimestampParser for lines that start with a timestamp
+// in the given time.Parse layout. Timestamps without a time zone are
+// interpreted in the local time zone.
+func ParseLayout(layout string) TimestampParser {
+	// The timestamp is assumed to have as many space separated fields as the
+	// layout does.
+	fields := strings.Count(layout, " ") + 1
+
+	return func(line string) (time.Time, string, bool) {
+		end := 0
+		for i := 0; i < fields; i++ {
+			next := strings.IndexByte(line[end:], ' ')
+			if next < 0 {
+				if i < fields-1 {
+					return time.Time{}, line, false
+				}
+				end = len(strings.TrimRight(line, "\r\n"))
+				break
+			}
+			end += next
+			if i < fields-1 {
+				end++
+			}
+		}
+
+		t, err := time.ParseInLocation(layout, line[:end], time.Local)
+		if err != nil {
+			return time.Time{}, line, false
+		}
+		return t, strings.TrimLeft(line[end:], " "), true
+	}
+}
+
+var (
+	// ParseRFC3339 parses lines that start with an RFC3339 timestamp, with
+	// or without fractional seconds.
+	ParseRFC3339 = ParseLayout(time.RFC3339Nano)
+
+	// ParseGoLog parses lines that start with the date and time written by
+	// the standard log package, with or without microseconds.
+	ParseGoLog = ParseLayout("2006/01/02 15:04:05")
+)
+
+// commonLogLayout is the layout of the timestamp in the Common Log Format
+// used by Apache and NGINX.
+const commonLogLayout = "02/Jan/2006:15:04:05 -0700"
+
+// ParseCommonLog parses lines in the Common Log Format, or the Combined Log
+// Format, used by Apache and NGINX, e.g.
+//
+//	127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326
+//
+// As the timestamp isn't at the start of the line, the rest of the line is
+// the line without the bracketed timestamp.
+func ParseCommonLog(line string) (time.Time, string, bool) {
+	start := strings.IndexByte(line, '[')
+	if start < 0 {
+		return time.Time{}, line, false
+	}
+	end := strings.IndexByte(line[start:], ']')
+	if end < 0 {
+		return time.Time{}, line, false
+	}
+	end += start
+
+	t, err := time.Parse(commonLogLayout, line[start+1:end])
+	if err != nil {
+		return time.Time{}, line, false
+	}
+	return t, line[:start] + strings.TrimLeft(line[end+1:], " "), true
+}
+
+// epochMillisDigits is the number of digits in the millisecond timestamps of
+// every time from 2001 until 2286.
+const epochMillisDigits = 13
+
+// ParseEpochMillis parses lines that start with the number of milliseconds
+// since the Unix epoch. The number must have 13 digits and be followed by a
+// space or the end of the line, so that lines which merely start with a
+// number, such as a status code, aren't mistaken for timestamps.
+func ParseEpochMillis(line string) (time.Time, string, bool) {
+	end := 0
+	for end < len(line) && line[end] >= '0' && line[end] <= '9' {
+		end++
+	}
+	if end != epochMillisDigits {
+		return time.Time{}, line, false
+	}
+	if end < len(line) && !strings.ContainsRune(" \r\n", rune(line[end])) {
+		return time.Time{}, line, false
+	}
+
+	ms, err := strconv.ParseInt(line[:end], 10, 64)
+	if err != nil {
+		return time.Time{}, line, false
+	}
+	return eventTime(ms), strings.TrimLeft(line[end:], " "), true
+}
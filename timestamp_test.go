@@ -0,0 +1,154 @@
+package cloudwatch
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimestampParsers(t *testing.T) {
+	tests := []struct {
+		name   string
+		parser TimestampParser
+		line   string
+		time   time.Time
+		rest   string
+		ok     bool
+	}{
+		{
+			name:   "rfc3339",
+			parser: ParseRFC3339,
+			line:   "2017-08-16T18:14:22.123Z Hello\n",
+			time:   time.Date(2017, 8, 16, 18, 14, 22, 123000000, time.UTC),
+			rest:   "Hello\n",
+			ok:     true,
+		},
+		{
+			name:   "rfc3339 only",
+			parser: ParseRFC3339,
+			line:   "2017-08-16T18:14:22Z\n",
+			time:   time.Date(2017, 8, 16, 18, 14, 22, 0, time.UTC),
+			rest:   "\n",
+			ok:     true,
+		},
+		{
+			name:   "go log",
+			parser: ParseGoLog,
+			line:   "2017/08/16 18:14:22.000123 Hello",
+			time:   time.Date(2017, 8, 16, 18, 14, 22, 123000, time.Local),
+			rest:   "Hello",
+			ok:     true,
+		},
+		{
+			name:   "common log",
+			parser: ParseCommonLog,
+			line:   `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`,
+			time:   time.Date(2000, 10, 10, 20, 55, 36, 0, time.UTC),
+			rest:   `127.0.0.1 - frank "GET /apache_pb.gif HTTP/1.0" 200 2326`,
+			ok:     true,
+		},
+		{
+			name:   "epoch millis",
+			parser: ParseEpochMillis,
+			line:   "1502907262123 Hello",
+			time:   time.Date(2017, 8, 16, 18, 14, 22, 123000000, time.UTC),
+			rest:   "Hello",
+			ok:     true,
+		},
+		{
+			name:   "no timestamp",
+			parser: ParseRFC3339,
+			line:   "Hello World",
+			rest:   "Hello World",
+		},
+		{
+			name:   "no brackets",
+			parser: ParseCommonLog,
+			line:   "Hello World",
+			rest:   "Hello World",
+		},
+		{
+			name:   "epoch millis only",
+			parser: ParseEpochMillis,
+			line:   "1502907262123\n",
+			time:   time.Date(2017, 8, 16, 18, 14, 22, 123000000, time.UTC),
+			rest:   "\n",
+			ok:     true,
+		},
+		{
+			name:   "no digits",
+			parser: ParseEpochMillis,
+			line:   "Hello",
+			rest:   "Hello",
+		},
+		{
+			name:   "status code",
+			parser: ParseEpochMillis,
+			line:   "404 Not Found",
+			rest:   "404 Not Found",
+		},
+		{
+			name:   "digits run on",
+			parser: ParseEpochMillis,
+			line:   "1502907262123abc",
+			rest:   "1502907262123abc",
+		},
+		{
+			name:   "too many digits",
+			parser: ParseEpochMillis,
+			line:   "15029072621234 Hello",
+			rest:   "15029072621234 Hello",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, rest, ok := tt.parser(tt.line)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.rest, rest)
+			assert.True(t, tt.time.Equal(parsed), "expected %s, got %s", tt.time, parsed)
+		})
+	}
+}
+
+func TestWriter_TimestampParser(t *testing.T) {
+	defer func(n func() time.Time) { now = n }(now)
+	now = func() time.Time { return time.Unix(1502907262, 0) }
+
+	c := new(mockClient)
+	w := &Writer{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: c,
+		core:   newStreamCore(),
+		opts: WriterOptions{
+			TimestampParser: ParseEpochMillis,
+			StripTimestamp:  true,
+		},
+	}
+
+	c.On("PutLogEvents", &cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("Hello\n"), Timestamp: aws.Int64(1502907261500)},
+			{Message: aws.String("404 Not Found\n"), Timestamp: aws.Int64(1502907262000)},
+			{Message: aws.String("0000000000500 Epoch\n"), Timestamp: aws.Int64(1502907262000)},
+			{Message: aws.String("World"), Timestamp: aws.Int64(1502907262000)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	}).Return(&cloudwatchlogs.PutLogEventsOutput{}, nil)
+
+	// Lines that start with a number that isn't a timestamp, or with a time
+	// that CloudWatch Logs wouldn't accept, are stamped with the current time.
+	_, err := io.WriteString(w, "1502907261500 Hello\n404 Not Found\n0000000000500 Epoch\nWorld")
+	assert.NoError(t, err)
+
+	err = w.Flush()
+	assert.NoError(t, err)
+
+	c.AssertExpectations(t)
+}
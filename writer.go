@@ -1,18 +1,18 @@
 package cloudwatch
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
-	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
 )
 
 const (
@@ -24,156 +24,697 @@ const (
 	// See: http://docs.aws.amazon.com/AmazonCloudWatch/latest/DeveloperGuide/cloudwatch_limits.html
 	maximumBytesPerEvent = 262144 - perEventBytes
 
+	// A batch of log events in a single PutLogEvents request cannot span more
+	// than 24 hours (expressed in milliseconds).
+	maximumBatchSpan = int64(24 * time.Hour / time.Millisecond)
+
+	// defaultPartialLineTimeout is how long a partial line waits for the rest
+	// of the line when WriterOptions.PartialLineTimeout isn't set.
+	defaultPartialLineTimeout = time.Second
+
+	// minIdleCheck is the shortest interval at which partial lines and
+	// multi-line events are checked for having waited too long.
+	minIdleCheck = time.Millisecond
+
 	dataAlreadyAcceptedCode  = "DataAlreadyAcceptedException"
 	invalidSequenceTokenCode = "InvalidSequenceTokenException"
+
+	// maxTokenRefreshes is how many times a flush retries with the sequence
+	// token from an InvalidSequenceTokenException. These retries don't count
+	// towards RetryPolicy.MaxAttempts, as they aren't for transient failures.
+	maxTokenRefreshes = 5
 )
 
+// RejectedLogEventsInfoError is returned when CloudWatch Logs accepted a
+// PutLogEvents request, but rejected some of the events in it.
 type RejectedLogEventsInfoError struct {
 	Info *cloudwatchlogs.RejectedLogEventsInfo
+
+	// The events that were rejected, by reason.
+	TooOld, TooNew, Expired []*cloudwatchlogs.InputLogEvent
+}
+
+func newRejectedLogEventsInfoError(info *cloudwatchlogs.RejectedLogEventsInfo, events []*cloudwatchlogs.InputLogEvent) *RejectedLogEventsInfoError {
+	// index clamps an index from info to the bounds of events.
+	index := func(i *int64) int {
+		switch {
+		case *i < 0:
+			return 0
+		case *i > int64(len(events)):
+			return len(events)
+		}
+		return int(*i)
+	}
+
+	e := &RejectedLogEventsInfoError{Info: info}
+	if info.TooOldLogEventEndIndex != nil {
+		e.TooOld = events[:index(info.TooOldLogEventEndIndex)]
+	}
+	if info.TooNewLogEventStartIndex != nil {
+		e.TooNew = events[index(info.TooNewLogEventStartIndex):]
+	}
+	if info.ExpiredLogEventEndIndex != nil {
+		e.Expired = events[:index(info.ExpiredLogEventEndIndex)]
+	}
+	return e
 }
 
 func (e *RejectedLogEventsInfoError) Error() string {
-	return fmt.Sprintf("log messages were rejected")
+	return fmt.Sprintf("log messages were rejected: %d too old, %d too new, %d expired",
+		len(e.TooOld), len(e.TooNew), len(e.Expired))
 }
 
 type WriterOptions struct {
 	FlushEvery time.Duration
+
+	// FlushBytes and FlushEvents trigger a flush as soon as the buffered
+	// events reach either size, rather than waiting for FlushEvery. They
+	// default to the size of a single PutLogEvents request. Only FlushBytes
+	// applies to a Spool.
+	FlushBytes  int
+	FlushEvents int
+
+	// Oversize determines how messages larger than the maximum event size
+	// are handled. Defaults to OversizeSplit.
+	Oversize OversizePolicy
+
+	// TruncateMarker is appended to messages truncated by OversizeTruncate.
+	// Markers longer than 1KB are cut short.
+	TruncateMarker string
+
+	// OnOversize receives oversized events when Oversize is OversizeHandler.
+	OnOversize func(*cloudwatchlogs.InputLogEvent)
+
+	// RetryPolicy controls how failed PutLogEvents requests are retried.
+	// Defaults to DefaultRetryPolicy.
+	RetryPolicy *RetryPolicy
+
+	// OnDropped is called with each batch of events that couldn't be
+	// delivered once the RetryPolicy gave up, and the last error.
+	OnDropped func(events []*cloudwatchlogs.InputLogEvent, err error)
+
+	// OnRejected is called when CloudWatch Logs rejects some of the events
+	// in a request for being too old, too new or expired.
+	OnRejected func(*RejectedLogEventsInfoError)
+
+	// ResendTooNew re-stamps events that were rejected for being too far in
+	// the future with the time of the next flush, and sends them again.
+	ResendTooNew bool
+
+	// Spool, if set, buffers events on disk rather than in memory, so that
+	// they survive outages and restarts.
+	Spool *SpoolOptions
+
+	// MaxBufferedEvents and MaxBufferedBytes limit the number and size of
+	// the events buffered in memory. Zero means there is no limit. They don't
+	// apply to a Spool, which has its own limits.
+	MaxBufferedEvents int
+	MaxBufferedBytes  int
+
+	// Overflow determines what happens when the buffer is full.
+	Overflow OverflowPolicy
+
+	// BlockTimeout is how long Write blocks, when Overflow is OverflowBlock,
+	// before giving up and returning ErrBufferFull. Zero means Write blocks
+	// until there is room.
+	BlockTimeout time.Duration
+
+	// SampleEvery is used by OverflowSample. Defaults to 10.
+	SampleEvery int
+
+	// TimestampParser, if set, is used to take the time of each event from
+	// the line written. Lines it can't parse, or whose time CloudWatch Logs
+	// wouldn't accept, are stamped with the current time.
+	TimestampParser TimestampParser
+
+	// StripTimestamp removes the timestamp found by TimestampParser from the
+	// message.
+	StripTimestamp bool
+
+	// Multiline, if set, folds lines that continue a previous line, such as
+	// those in a stack trace, into a single event.
+	Multiline *MultilineOptions
+
+	// PartialLineTimeout is how long the end of a write that isn't
+	// terminated by a newline waits for the rest of its line before it is
+	// buffered as an event of its own. Defaults to one second.
+	PartialLineTimeout time.Duration
+
+	// StripNewlines removes the trailing newline from each message.
+	StripNewlines bool
 }
 
 // Writer is an io.Writer implementation that writes lines to a cloudwatch logs
 // stream.
 type Writer struct {
-	group, stream, sequenceToken *string
-
-	client cloudwatchlogsiface.CloudWatchLogsAPI
+	group, stream *string
+
+	client Client
+
+	opts WriterOptions
+
+	// closed is set by Close, after which Write fails, and finished once
+	// Close has sent the buffered events. closeOnce stops the flushing
+	// goroutine.
+	closed    int32 // Accessed atomically.
+	finished  int32 // Accessed atomically.
+	closeOnce sync.Once
+
+	// Err holds the last error that occurred while flushing.
+	//
+	// Deprecated: Use the errors returned by Flush and Close.
+	Err error
+
+	// err is an error that caused events to be lost, which is returned by
+	// the next call to Write after it has buffered its input.
+	err     error
+	errLock sync.Mutex
+
+	// tooNew holds events to be re-stamped and sent by the next flush.
+	tooNew []*cloudwatchlogs.InputLogEvent
+
+	// core is shared with the other Writers of the stream that were
+	// attached through the same Group, and release gives it back when the
+	// Writer is closed.
+	core    *streamCore
+	release func()
+
+	events    eventsBuffer
+	spool     *spool
+	multiline *multiline
+
+	// partial holds the end of a write that wasn't terminated by a newline,
+	// and when the line was started.
+	partial struct {
+		sync.Mutex
+		b     []byte
+		since time.Time
+	}
 
-	closed bool
-	Err    error
+	flushTicker *time.Ticker
 
-	events eventsBuffer
+	// flushNow triggers a flush before the next tick.
+	flushNow chan struct{}
 
-	flushTicker <-chan time.Time
+	// done is closed to stop the flushing goroutine, which closes stopped
+	// once it has exited.
+	done, stopped chan struct{}
 
 	sync.Mutex // This protects calls to flush.
 }
 
-func NewWriter(group, stream string, client cloudwatchlogsiface.CloudWatchLogsAPI, opts WriterOptions) *Writer {
+// NewWriter returns a Writer for the given stream.
+//
+// If opts.Spool is set but the spool can't be opened, the error is logged and
+// events are buffered in memory instead.
+func NewWriter(group, stream string, client Client, opts WriterOptions) *Writer {
+	w, err := newWriter(group, stream, client, opts, newStreamCore())
+	if err != nil {
+		FallbackLogger.Errorln("error opening spool, buffering in memory", err)
+		opts.Spool = nil
+		w, _ = newWriter(group, stream, client, opts, newStreamCore())
+	}
+	return w
+}
+
+func newWriter(group, stream string, client Client, opts WriterOptions, core *streamCore) (*Writer, error) {
+	if opts.FlushEvery <= 0 {
+		opts.FlushEvery = defaultFlushEvery
+	}
+	if opts.FlushBytes <= 0 {
+		opts.FlushBytes = maximumBytesPerPut
+	}
+	if opts.FlushEvents <= 0 {
+		opts.FlushEvents = maximumLogEventsPerPut
+	}
+	if len(opts.TruncateMarker) > maximumTruncateMarkerBytes {
+		opts.TruncateMarker, _ = splitUTF8(opts.TruncateMarker, maximumTruncateMarkerBytes)
+	}
+
 	w := &Writer{
-		group:       aws.String(group),
-		stream:      aws.String(stream),
-		client:      client,
-		flushTicker: time.Tick(opts.FlushEvery),
+		group:    aws.String(group),
+		stream:   aws.String(stream),
+		client:   client,
+		opts:     opts,
+		core:     core,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		flushNow: make(chan struct{}, 1),
+		events: eventsBuffer{
+			maxEvents:    opts.MaxBufferedEvents,
+			maxBytes:     opts.MaxBufferedBytes,
+			overflow:     opts.Overflow,
+			sampleEvery:  opts.SampleEvery,
+			blockTimeout: opts.BlockTimeout,
+		},
 	}
+
+	w.events.onFull = w.flushSoon
+
+	if opts.Multiline != nil {
+		w.multiline = newMultiline(*opts.Multiline)
+	}
+
+	if opts.Spool != nil {
+		s, err := openSpool(*opts.Spool, opts.OnDropped)
+		if err != nil {
+			return nil, err
+		}
+		w.spool = s
+	}
+
+	w.flushTicker = time.NewTicker(opts.FlushEvery)
 	go w.start() // start flushing
-	return w
+	return w, nil
 }
 
 // Write takes b, and creates cloudwatch log events for each individual line.
-// If Flush returns an error, subsequent calls to Write will fail.
+// If events were lost since the last call, for instance because Flush
+// failed, the error is returned once b has been buffered. b is never
+// discarded because of an earlier failure.
 func (w *Writer) Write(b []byte) (int, error) {
-	if w.closed {
+	if atomic.LoadInt32(&w.closed) != 0 {
 		return 0, io.ErrClosedPipe
 	}
 
-	// if w.err != nil {
-	// w.err = nil
-	// return 0, w.err
-	// }
-
-	return w.buffer(b)
+	n, err := w.buffer(b)
+	if err != nil {
+		return n, err
+	}
+	return n, w.takeErr()
 }
 
-// starts continously flushing the buffered events.
-func (w *Writer) start() error {
+// starts continously flushing the buffered events, until done is closed.
+func (w *Writer) start() {
+	defer close(w.stopped)
+	defer w.flushTicker.Stop()
+
+	// Send anything left in the spool by a previous process straight away.
+	if w.spool != nil {
+		w.Flush()
+	}
+
+	// Check for partial lines and multi-line events that have stopped
+	// receiving input.
+	idle := time.NewTicker(w.idleCheckEvery())
+	defer idle.Stop()
+
 	for {
-		// Exit if the stream is closed.
-		if w.closed {
-			return nil
+		select {
+		case <-w.done:
+			return
+		case <-w.flushTicker.C:
+			w.Flush()
+		case <-w.flushNow:
+			w.Flush()
+		case <-idle.C:
+			w.bufferPending(w.pendingEvents(false))
+		}
+	}
+}
+
+// Close flushes any buffered events and closes the writer. Any subsequent
+// calls to Write will return io.ErrClosedPipe.
+func (w *Writer) Close() error {
+	return w.CloseContext(context.Background())
+}
+
+// CloseContext is like Close, but gives up waiting for the events to be
+// flushed when ctx is done. The events that weren't sent stay buffered, and
+// calling Close or CloseContext again tries to send them.
+func (w *Writer) CloseContext(ctx context.Context) error {
+	if atomic.LoadInt32(&w.finished) != 0 {
+		return nil
+	}
+	atomic.StoreInt32(&w.closed, 1)
+
+	// Wait for the flushing goroutine to finish what it's doing and exit, so
+	// that the flushes below are the last ones.
+	if w.done != nil {
+		w.closeOnce.Do(func() { close(w.done) })
+		select {
+		case <-w.stopped:
+		case <-ctx.Done():
+			return ctx.Err()
 		}
+	}
 
-		<-w.flushTicker
-		w.Flush()
+	err := w.FlushContext(ctx) // Flush remaining buffer.
+	if err != nil && ctx.Err() != nil {
+		return err
 	}
+
+	if !atomic.CompareAndSwapInt32(&w.finished, 0, 1) {
+		return err
+	}
+	if w.release != nil {
+		defer w.release()
+	}
+	if w.spool != nil {
+		if cerr := w.spool.close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
 }
 
-// Closes the writer. Any subsequent calls to Write will return
-// io.ErrClosedPipe.
-func (w *Writer) Close() {
-	w.closed = true
-	w.Flush() // Flush remaining buffer.
-	return
+// Flush flushes the events that are currently buffered. It returns the first
+// error that occurred, in which case some events may not have been delivered.
+func (w *Writer) Flush() error {
+	return w.FlushContext(context.Background())
 }
 
-// Flush flushes the events that are currently buffered.
-func (w *Writer) Flush() {
+// FlushContext is like Flush, but gives up when ctx is done. Events that
+// weren't sent because ctx was done stay buffered.
+func (w *Writer) FlushContext(ctx context.Context) error {
 	w.Lock()
 	defer w.Unlock()
 
-	events := w.events.drain()
+	w.bufferPending(w.pendingEvents(true))
+
+	if w.spool != nil {
+		return w.flushSpool(ctx)
+	}
+
+	events := append(w.events.drain(), w.restampTooNew()...)
 
 	// No events to flush.
 	if len(events) == 0 {
-		return
+		return nil
+	}
+
+	// Each batch is flushed in order so that the sequence token returned by
+	// one request is used for the next.
+	var (
+		firstErr error
+		sent     int
+	)
+
+	events, invalid := prepare(events)
+	if invalid != nil {
+		w.dropped(invalidEvents(invalid), invalid)
+		firstErr = invalid
+	}
+	for _, batch := range batches(events) {
+		if err := w.flush(ctx, batch); err != nil {
+			if _, ok := err.(*RejectedLogEventsInfoError); !ok {
+				if ctx.Err() != nil {
+					// Put back everything that hasn't been sent, so that it
+					// can be sent by the next flush.
+					w.events.prepend(events[sent:])
+					return err
+				}
+				w.dropped(batch, err)
+			}
+
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		sent += len(batch)
 	}
 
-	w.flush(events)
-	return
+	// Now that events are being delivered again, let the reader of the
+	// stream know if any were dropped because the buffer was full.
+	if firstErr == nil {
+		if dropped := w.events.takeDropped(); dropped > 0 {
+			w.events.prepend([]*cloudwatchlogs.InputLogEvent{{
+				Message:   aws.String(fmt.Sprintf("%d events dropped", dropped)),
+				Timestamp: aws.Int64(timestamp(now())),
+			}})
+		}
+	}
+	return firstErr
 }
 
-// flush flushes a slice of log events. This method should be called
-// sequentially to ensure that the sequence token is updated properly.
-func (w *Writer) flush(events []*cloudwatchlogs.InputLogEvent) {
+// flushSpool seals the active spool segment and sends every sealed segment,
+// oldest first. A segment is deleted once all of its events have been sent.
+// If the retry policy gives up on a retryable error, the events that weren't
+// sent are kept in the spool for the next flush.
+func (w *Writer) flushSpool(ctx context.Context) error {
+	if err := w.spool.seal(); err != nil {
+		return err
+	}
 
-	nextSequenceToken, err := w.putLogEvents(events, w.sequenceToken)
+	var firstErr error
 
-	if err != nil {
-		if awsErr, ok := err.(awserr.Error); ok {
-			if awsErr.Code() == dataAlreadyAcceptedCode {
-				// already submitted, just grab the correct sequence token
-				parts := strings.Split(awsErr.Message(), " ")
-				nextSequenceToken = &parts[len(parts)-1]
-				// TODO log locally...
-				FallbackLogger.Errorln(
-					"Data already accepted, ignoring error",
-					"errorCode: ", awsErr.Code(),
-					"message: ", awsErr.Message(),
-					"logGroupName: ", *w.group,
-					"logStreamName: ", *w.stream,
-				)
-				err = nil
-			} else if awsErr.Code() == invalidSequenceTokenCode {
-				// sequence code is bad, grab the correct one and retry
-				parts := strings.Split(awsErr.Message(), " ")
-				token := parts[len(parts)-1]
-				nextSequenceToken, err = w.putLogEvents(events, &token)
+	if tooNew := w.restampTooNew(); len(tooNew) > 0 {
+		if err := w.spool.append(tooNew); err != nil {
+			return err
+		}
+		if err := w.spool.seal(); err != nil {
+			return err
+		}
+	}
+
+	defer w.spool.send(nil)
+	for _, seg := range w.spool.sealed() {
+		// Stop the segment being dropped to make room while it's sent.
+		w.spool.send(seg)
+
+		events, err := readSegment(seg.path)
+		if err != nil {
+			// Carry on with the rest, rather than letting a broken segment
+			// hold them up for good.
+			FallbackLogger.Errorln("error reading spool segment, setting it aside", seg.path, err)
+			if err := w.spool.setAside(seg); err != nil {
+				FallbackLogger.Errorln("error setting aside spool segment", seg.path, err)
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		events, invalid := prepare(events)
+		if invalid != nil {
+			w.dropped(invalidEvents(invalid), invalid)
+			if firstErr == nil {
+				firstErr = invalid
+			}
+		}
+
+		sent := 0
+		for _, batch := range batches(events) {
+			if err := w.flush(ctx, batch); err != nil {
+				if _, ok := err.(*RejectedLogEventsInfoError); !ok {
+					if ctx.Err() != nil || w.retryPolicy().retryable(err) {
+						if err := w.spool.rewrite(seg, events[sent:]); err != nil {
+							FallbackLogger.Errorln("error rewriting spool segment", seg.path, err)
+						}
+						return err
+					}
+					w.dropped(batch, err)
+				}
+
+				if firstErr == nil {
+					firstErr = err
+				}
 			}
+			sent += len(batch)
+		}
+
+		if err := w.spool.remove(seg); err != nil {
+			return err
 		}
 	}
 
-	if err != nil {
-		w.Err = err
-		FallbackLogger.Errorln("error flushing", err)
-	} else {
-		w.sequenceToken = nextSequenceToken
+	return firstErr
+}
+
+// dropped reports events that won't be delivered.
+func (w *Writer) dropped(events []*cloudwatchlogs.InputLogEvent, err error) {
+	w.setErr(err)
+
+	if w.opts.OnDropped != nil {
+		w.opts.OnDropped(events, err)
+	}
+}
+
+// invalidEvents converts the events in err back to log events, to be
+// reported as dropped.
+func invalidEvents(err *TimestampRangeError) []*cloudwatchlogs.InputLogEvent {
+	events := make([]*cloudwatchlogs.InputLogEvent, len(err.Events))
+	for i, event := range err.Events {
+		events[i] = &cloudwatchlogs.InputLogEvent{
+			Message:   aws.String(event.Message),
+			Timestamp: aws.Int64(timestamp(event.Timestamp)),
+		}
+	}
+	return events
+}
+
+// rejected reports events that CloudWatch Logs rejected, and holds on to the
+// ones that were too new if they should be sent again.
+func (w *Writer) rejected(err *RejectedLogEventsInfoError) {
+	w.setErr(err)
+
+	if w.opts.ResendTooNew {
+		w.tooNew = append(w.tooNew, err.TooNew...)
+	}
+
+	if w.opts.OnRejected != nil {
+		w.opts.OnRejected(err)
+	}
+}
+
+// restampTooNew returns the events that were rejected for being too new,
+// stamped with the current time.
+func (w *Writer) restampTooNew() []*cloudwatchlogs.InputLogEvent {
+	events := w.tooNew
+	w.tooNew = nil
+
+	stamp := aws.Int64(timestamp(now()))
+	restamped := make([]*cloudwatchlogs.InputLogEvent, len(events))
+	for i, event := range events {
+		restamped[i] = &cloudwatchlogs.InputLogEvent{
+			Message:   event.Message,
+			Timestamp: stamp,
+		}
+	}
+	return restamped
+}
+
+// setErr records an error to be returned by the next call to Write.
+func (w *Writer) setErr(err error) {
+	w.errLock.Lock()
+	defer w.errLock.Unlock()
+
+	w.err = err
+}
+
+// takeErr returns and clears the error recorded by setErr.
+func (w *Writer) takeErr() error {
+	w.errLock.Lock()
+	defer w.errLock.Unlock()
+
+	err := w.err
+	w.err = nil
+	return err
+}
+
+func (w *Writer) retryPolicy() *RetryPolicy {
+	if w.opts.RetryPolicy == nil {
+		return &DefaultRetryPolicy
 	}
+	return w.opts.RetryPolicy
+}
+
+// flush flushes a slice of log events, retrying according to the writer's
+// RetryPolicy. This method should be called sequentially to ensure that the
+// sequence token is updated properly.
+func (w *Writer) flush(ctx context.Context, events []*cloudwatchlogs.InputLogEvent) error {
+	policy := w.retryPolicy()
+
+	var err error
+	refreshes := 0
+	for attempt := 1; ; attempt++ {
+		var resp *cloudwatchlogs.PutLogEventsOutput
+		resp, err = w.putLogEvents(ctx, events)
+		if err == nil {
+			if resp.RejectedLogEventsInfo != nil {
+				rerr := newRejectedLogEventsInfoError(resp.RejectedLogEventsInfo, events)
+				w.Err = rerr
+				FallbackLogger.Errorln("error flushing", rerr)
+				w.rejected(rerr)
+				return rerr
+			}
+			return nil
+		}
+
+		awsErr, ok := err.(awserr.Error)
+		if ok && awsErr.Code() == dataAlreadyAcceptedCode {
+			// already submitted, putLogEvents has taken the correct
+			// sequence token
+			// TODO log locally...
+			FallbackLogger.Errorln(
+				"Data already accepted, ignoring error",
+				"errorCode: ", awsErr.Code(),
+				"message: ", awsErr.Message(),
+				"logGroupName: ", *w.group,
+				"logStreamName: ", *w.stream,
+			)
+			return nil
+		}
+
+		if ok && awsErr.Code() == invalidSequenceTokenCode && refreshes < maxTokenRefreshes {
+			// sequence code is bad, putLogEvents has taken the correct one,
+			// so retry straight away without using up an attempt
+			refreshes++
+			attempt--
+			continue
+		}
 
-	// if resp.RejectedLogEventsInfo != nil {
-	// w.err = &RejectedLogEventsInfoError{Info: resp.RejectedLogEventsInfo}
-	// return w.err
-	// }
+		if attempt >= policy.MaxAttempts {
+			break
+		}
+
+		if ctx.Err() != nil || !policy.retryable(err) {
+			break
+		}
 
-	return
+		if serr := sleep(ctx, policy.delay(attempt)); serr != nil {
+			err = serr
+			break
+		}
+	}
+
+	w.Err = err
+	FallbackLogger.Errorln("error flushing", err)
+
+	return err
+}
+
+// expectedSequenceToken extracts the sequence token that CloudWatch Logs
+// expected from an InvalidSequenceTokenException or
+// DataAlreadyAcceptedException.
+func expectedSequenceToken(awsErr awserr.Error) *string {
+	parts := strings.Split(awsErr.Message(), " ")
+	return &parts[len(parts)-1]
 }
 
-func (w *Writer) putLogEvents(events []*cloudwatchlogs.InputLogEvent, sequenceToken *string) (nextSequenceToken *string, err error) {
-	resp, err := w.client.PutLogEvents(&cloudwatchlogs.PutLogEventsInput{
+// putLogEvents makes a single PutLogEvents request with the stream's
+// sequence token, and updates the token from the response or error. The
+// stream is held only for the request, so that the other Writers sharing it
+// aren't held up by this one's retries.
+func (w *Writer) putLogEvents(ctx context.Context, events []*cloudwatchlogs.InputLogEvent) (resp *cloudwatchlogs.PutLogEventsOutput, err error) {
+	core := w.core
+
+	// Stay within the per stream rate limit, by reserving the next slot
+	// before waiting for it.
+	if err := core.lock(ctx); err != nil {
+		return nil, err
+	}
+	at := core.lastPut.Add(putThrottle)
+	if t := now(); at.Before(t) {
+		at = t
+	}
+	core.lastPut = at
+	core.unlock()
+
+	if wait := at.Sub(now()); wait > 0 {
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := core.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer core.unlock()
+
+	resp, err = w.client.PutLogEventsWithContext(ctx, &cloudwatchlogs.PutLogEventsInput{
 		LogEvents:     events,
 		LogGroupName:  w.group,
 		LogStreamName: w.stream,
-		SequenceToken: sequenceToken,
+		SequenceToken: core.sequenceToken,
 	})
 	if err != nil {
 		if awsErr, ok := err.(awserr.Error); ok {
+			switch awsErr.Code() {
+			case invalidSequenceTokenCode, dataAlreadyAcceptedCode:
+				core.sequenceToken = expectedSequenceToken(awsErr)
+			}
 			if awsErr.Code() != invalidSequenceTokenCode {
 				FallbackLogger.Errorf(
 					"Failed to put log: events: errorCode: %s message: %s, origError: %s log-group: %s log-stream: %s",
@@ -188,67 +729,280 @@ func (w *Writer) putLogEvents(events []*cloudwatchlogs.InputLogEvent, sequenceTo
 			FallbackLogger.Errorf("Failed to put log: %s", err)
 		}
 
-		return
+		return nil, err
 	}
 
-	nextSequenceToken = resp.NextSequenceToken
-	return
+	core.sequenceToken = resp.NextSequenceToken
+	return resp, nil
 }
 
-// buffer splits up b into individual log events and inserts them into the
-// buffer.
-func (w *Writer) buffer(b []byte) (int, error) {
-	r := bufio.NewReader(bytes.NewReader(b))
-
+// batches splits events into slices that can each be sent in a single
+// PutLogEvents request without exceeding the byte, event count or time span
+// limits. The order of the events is preserved.
+func batches(events []*cloudwatchlogs.InputLogEvent) [][]*cloudwatchlogs.InputLogEvent {
 	var (
-		n   int
-		eof bool
+		all   [][]*cloudwatchlogs.InputLogEvent
+		batch []*cloudwatchlogs.InputLogEvent
+
+		size             int
+		earliest, latest int64
 	)
 
-	for !eof {
-		b, err := r.ReadBytes('\n')
-		if err != nil {
-			if err == io.EOF {
-				eof = true
-			} else {
-				break
+	for _, event := range events {
+		eventSize := len(*event.Message) + perEventBytes
+		timestamp := *event.Timestamp
+
+		if len(batch) > 0 {
+			if timestamp < earliest {
+				earliest = timestamp
+			}
+			if timestamp > latest {
+				latest = timestamp
+			}
+
+			if size+eventSize > maximumBytesPerPut ||
+				len(batch) == maximumLogEventsPerPut ||
+				latest-earliest > maximumBatchSpan {
+				all = append(all, batch)
+				batch, size = nil, 0
 			}
 		}
 
-		if len(b) == 0 {
-			continue
+		if len(batch) == 0 {
+			earliest, latest = timestamp, timestamp
+		}
+
+		batch = append(batch, event)
+		size += eventSize
+	}
+
+	if len(batch) > 0 {
+		all = append(all, batch)
+	}
+
+	return all
+}
+
+// buffer splits up b into individual log events and inserts them into the
+// buffer. A line that isn't finished by the end of b is kept until it is, or
+// until it has waited for PartialLineTimeout.
+func (w *Writer) buffer(b []byte) (int, error) {
+	var lines []string
+
+	w.partial.Lock()
+	data := append(w.partial.b, b...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
 		}
+		lines = append(lines, string(data[:i+1]))
+		data = data[i+1:]
+	}
 
-		w.events.add(&cloudwatchlogs.InputLogEvent{
-			Message:   aws.String(string(b)),
-			Timestamp: aws.Int64(now().UnixNano() / 1000000),
-		})
+	// A line that is already as large as an event can be won't get any
+	// better by waiting for the rest of it.
+	if len(data) >= maximumBytesPerEvent {
+		lines = append(lines, string(data))
+		data = nil
+	}
+
+	// Note when the partial line was started, unless it continues one from
+	// an earlier write.
+	if len(data) > 0 && (len(w.partial.b) == 0 || len(lines) > 0) {
+		w.partial.since = now()
+	}
+	w.partial.b = data
+	w.partial.Unlock()
 
-		n += len(b)
+	var events []*cloudwatchlogs.InputLogEvent
+	for _, line := range lines {
+		events = append(events, w.lineEvents(line)...)
 	}
 
-	return n, nil
+	if err := w.enqueue(events); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
 }
 
-// eventsBuffer represents a buffer of cloudwatch events that are protected by a
-// mutex.
-type eventsBuffer struct {
-	sync.Mutex
-	events []*cloudwatchlogs.InputLogEvent
+// lineEvents creates the events for a complete line. If the writer folds
+// multi-line events, the line may be held back, or complete a previous event.
+func (w *Writer) lineEvents(line string) []*cloudwatchlogs.InputLogEvent {
+	if w.multiline != nil {
+		return w.complete(w.multiline.add(line, w.event))
+	}
+	return w.complete(w.event(line))
 }
 
-func (b *eventsBuffer) add(event *cloudwatchlogs.InputLogEvent) {
-	b.Lock()
-	defer b.Unlock()
+// complete prepares a line event to be buffered, stripping its newline if
+// the writer is configured to and applying the OversizePolicy.
+func (w *Writer) complete(event *cloudwatchlogs.InputLogEvent) []*cloudwatchlogs.InputLogEvent {
+	if event == nil {
+		return nil
+	}
+
+	if w.opts.StripNewlines {
+		message := strings.TrimRight(*event.Message, "\r\n")
+		if message == "" {
+			return nil
+		}
+		event.Message = aws.String(message)
+	}
 
-	b.events = append(b.events, event)
+	return w.fit(event)
 }
 
-func (b *eventsBuffer) drain() []*cloudwatchlogs.InputLogEvent {
-	b.Lock()
-	defer b.Unlock()
+// pendingEvents returns the events that have been held back waiting for more
+// input. If all is false, only those that have waited too long are returned.
+func (w *Writer) pendingEvents(all bool) []*cloudwatchlogs.InputLogEvent {
+	var events []*cloudwatchlogs.InputLogEvent
+
+	w.partial.Lock()
+	var line string
+	if len(w.partial.b) > 0 && (all || now().Sub(w.partial.since) >= w.partialLineTimeout()) {
+		line = string(w.partial.b)
+		w.partial.b = nil
+	}
+	w.partial.Unlock()
+
+	if line != "" {
+		events = append(events, w.lineEvents(line)...)
+	}
+
+	if w.multiline != nil {
+		if all {
+			events = append(events, w.complete(w.multiline.flush())...)
+		} else {
+			events = append(events, w.complete(w.multiline.idle())...)
+		}
+	}
 
-	events := b.events[:]
-	b.events = nil
 	return events
 }
+
+// idleCheckEvery returns how often to check for partial lines and multi-line
+// events that have stopped receiving input: twice per timeout, but no more
+// often than minIdleCheck.
+func (w *Writer) idleCheckEvery() time.Duration {
+	every := w.partialLineTimeout()
+	if w.multiline != nil && w.multiline.opts.IdleTimeout < every {
+		every = w.multiline.opts.IdleTimeout
+	}
+	if every /= 2; every < minIdleCheck {
+		every = minIdleCheck
+	}
+	return every
+}
+
+func (w *Writer) partialLineTimeout() time.Duration {
+	if w.opts.PartialLineTimeout <= 0 {
+		return defaultPartialLineTimeout
+	}
+	return w.opts.PartialLineTimeout
+}
+
+// event creates a log event for a line, taking its time from the line if the
+// writer has a TimestampParser. A parsed time outside the range CloudWatch
+// Logs accepts is ignored, as it's more likely to be something that looks
+// like a timestamp than a stale event.
+func (w *Writer) event(line string) *cloudwatchlogs.InputLogEvent {
+	t := now()
+	if w.opts.TimestampParser != nil {
+		if parsed, rest, ok := w.opts.TimestampParser(line); ok && validTimestamp(parsed) {
+			t = parsed
+			if w.opts.StripTimestamp {
+				line = rest
+			}
+		}
+	}
+
+	return &cloudwatchlogs.InputLogEvent{
+		Message:   aws.String(line),
+		Timestamp: aws.Int64(timestamp(t)),
+	}
+}
+
+// bufferPending buffers events that were held back waiting for more input.
+// Unlike enqueue it never blocks, as it's used while flushing.
+func (w *Writer) bufferPending(events []*cloudwatchlogs.InputLogEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	if w.spool != nil {
+		if err := w.spool.append(events); err != nil {
+			FallbackLogger.Errorln("error appending to spool", err)
+			w.dropped(events, err)
+		}
+		return
+	}
+
+	w.events.Lock()
+	defer w.events.Unlock()
+
+	for _, event := range events {
+		w.events.push(event)
+	}
+}
+
+// enqueue adds events to the spool, if there is one, or the in-memory buffer.
+func (w *Writer) enqueue(events []*cloudwatchlogs.InputLogEvent) error {
+	if w.spool != nil {
+		defer w.flushIfFull()
+		return w.spool.append(events)
+	}
+
+	for _, event := range events {
+		dropped, err := w.events.add(event)
+		if len(dropped) > 0 && w.opts.OnDropped != nil {
+			w.opts.OnDropped(dropped, ErrBufferFull)
+		}
+		if err != nil {
+			return err
+		}
+
+		// Check after every event, so that a flush is already on its way if
+		// the next one has to wait for room in the buffer.
+		w.flushIfFull()
+	}
+	return nil
+}
+
+// flushIfFull triggers a flush if the buffered events have reached the
+// FlushBytes or FlushEvents threshold, or the limits of the buffer.
+func (w *Writer) flushIfFull() {
+	if w.flushNow == nil {
+		return
+	}
+
+	var full bool
+	if w.spool != nil {
+		full = w.spool.unsentBytes() >= int64(w.opts.FlushBytes)
+	} else {
+		events, bytes := w.events.size()
+		full = events >= w.opts.FlushEvents || bytes >= w.opts.FlushBytes ||
+			(w.opts.MaxBufferedEvents > 0 && events >= w.opts.MaxBufferedEvents) ||
+			(w.opts.MaxBufferedBytes > 0 && bytes >= w.opts.MaxBufferedBytes)
+	}
+
+	if full {
+		w.flushSoon()
+	}
+}
+
+// flushSoon triggers a flush before the next tick.
+func (w *Writer) flushSoon() {
+	select {
+	case w.flushNow <- struct{}{}:
+	default:
+		// A flush has already been triggered.
+	}
+}
+
+// Dropped returns the number of events that have been dropped because the
+// buffer was full.
+func (w *Writer) Dropped() int64 {
+	return w.events.droppedTotal()
+}
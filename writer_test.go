@@ -1,19 +1,27 @@
 package cloudwatch
 
 import (
+	"context"
 	"io"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/eltorocorp/cloudwatch/cloudwatchtest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func init() {
 	now = func() time.Time {
 		return time.Unix(1, 0)
 	}
+	sleep = func(context.Context, time.Duration) error { return nil }
 }
 
 func TestWriter(t *testing.T) {
@@ -22,6 +30,7 @@ func TestWriter(t *testing.T) {
 		group:  aws.String("group"),
 		stream: aws.String("1234"),
 		client: c,
+		core:   newStreamCore(),
 	}
 
 	c.On("PutLogEvents", &cloudwatchlogs.PutLogEventsInput{
@@ -49,6 +58,7 @@ func TestWriter_Rejected(t *testing.T) {
 		group:  aws.String("group"),
 		stream: aws.String("1234"),
 		client: c,
+		core:   newStreamCore(),
 	}
 
 	c.On("PutLogEvents", &cloudwatchlogs.PutLogEventsInput{
@@ -77,12 +87,117 @@ func TestWriter_Rejected(t *testing.T) {
 	c.AssertExpectations(t)
 }
 
+func TestWriter_WriteAfterRejected(t *testing.T) {
+	c := new(mockClient)
+	w := &Writer{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: c,
+		core:   newStreamCore(),
+	}
+
+	c.On("PutLogEvents", &cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("Hello\n"), Timestamp: aws.Int64(1000)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	}).Return(&cloudwatchlogs.PutLogEventsOutput{
+		RejectedLogEventsInfo: &cloudwatchlogs.RejectedLogEventsInfo{
+			TooOldLogEventEndIndex: aws.Int64(1),
+		},
+	}, nil)
+	c.On("PutLogEvents", &cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("important\n"), Timestamp: aws.Int64(1000)},
+			{Message: aws.String("event"), Timestamp: aws.Int64(1000)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	}).Return(&cloudwatchlogs.PutLogEventsOutput{}, nil)
+
+	io.WriteString(w, "Hello\n")
+	assert.Error(t, w.Flush())
+
+	// The earlier rejection is reported, but the new input is still sent.
+	n, err := io.WriteString(w, "important\n")
+	assert.Equal(t, 10, n)
+	assert.IsType(t, &RejectedLogEventsInfoError{}, err)
+	assert.NoError(t, w.WriteEvent(Event{Message: "event"}))
+
+	assert.NoError(t, w.Flush())
+
+	c.AssertExpectations(t)
+}
+
+func TestWriter_RejectedEvents(t *testing.T) {
+	var rejected *RejectedLogEventsInfoError
+
+	c := new(mockClient)
+	w := &Writer{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: c,
+		core:   newStreamCore(),
+		opts: WriterOptions{
+			OnRejected: func(err *RejectedLogEventsInfoError) {
+				rejected = err
+			},
+			ResendTooNew: true,
+		},
+	}
+
+	c.On("PutLogEvents", &cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("old\n"), Timestamp: aws.Int64(1000)},
+			{Message: aws.String("ok\n"), Timestamp: aws.Int64(1000)},
+			{Message: aws.String("new\n"), Timestamp: aws.Int64(1000)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	}).Once().Return(&cloudwatchlogs.PutLogEventsOutput{
+		NextSequenceToken: aws.String("next"),
+		RejectedLogEventsInfo: &cloudwatchlogs.RejectedLogEventsInfo{
+			TooOldLogEventEndIndex:   aws.Int64(1),
+			TooNewLogEventStartIndex: aws.Int64(2),
+		},
+	}, nil)
+
+	c.On("PutLogEvents", &cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("new\n"), Timestamp: aws.Int64(1000)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+		SequenceToken: aws.String("next"),
+	}).Once().Return(&cloudwatchlogs.PutLogEventsOutput{}, nil)
+
+	io.WriteString(w, "old\nok\nnew\n")
+
+	err := w.Flush()
+	assert.Equal(t, rejected, err)
+	if assert.NotNil(t, rejected) {
+		assert.Equal(t, 1, len(rejected.TooOld))
+		assert.Equal(t, "old\n", *rejected.TooOld[0].Message)
+		assert.Equal(t, 1, len(rejected.TooNew))
+		assert.Equal(t, "new\n", *rejected.TooNew[0].Message)
+		assert.Empty(t, rejected.Expired)
+	}
+
+	// The too new event is sent again.
+	err = w.Flush()
+	assert.NoError(t, err)
+
+	c.AssertExpectations(t)
+}
+
 func TestWriter_NewLine(t *testing.T) {
 	c := new(mockClient)
 	w := &Writer{
 		group:  aws.String("group"),
 		stream: aws.String("1234"),
 		client: c,
+		core:   newStreamCore(),
 	}
 
 	c.On("PutLogEvents", &cloudwatchlogs.PutLogEventsInput{
@@ -103,12 +218,101 @@ func TestWriter_NewLine(t *testing.T) {
 	c.AssertExpectations(t)
 }
 
+func TestWriter_PartialLines(t *testing.T) {
+	c := new(mockClient)
+	w := &Writer{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: c,
+		core:   newStreamCore(),
+	}
+
+	c.On("PutLogEvents", &cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("Hello World\n"), Timestamp: aws.Int64(1000)},
+			{Message: aws.String("Goodbye"), Timestamp: aws.Int64(1000)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	}).Return(&cloudwatchlogs.PutLogEventsOutput{}, nil)
+
+	for _, chunk := range []string{"Hel", "lo ", "World\nGood", "bye"} {
+		n, err := io.WriteString(w, chunk)
+		assert.NoError(t, err)
+		assert.Equal(t, len(chunk), n)
+	}
+
+	// Only the complete line is buffered until Flush.
+	events, _ := w.events.size()
+	assert.Equal(t, 1, events)
+
+	err := w.Flush()
+	assert.NoError(t, err)
+
+	c.AssertExpectations(t)
+}
+
+func TestWriter_PartialLineTimeout(t *testing.T) {
+	w := &Writer{opts: WriterOptions{PartialLineTimeout: time.Second}}
+
+	io.WriteString(w, "Hello")
+	assert.Empty(t, w.pendingEvents(false))
+
+	defer func(n func() time.Time) { now = n }(now)
+	now = func() time.Time { return time.Unix(2, 0) }
+
+	assert.Equal(t, []string{"Hello"}, messages(w.pendingEvents(false)))
+}
+
+func TestWriter_ShortIdleTimeouts(t *testing.T) {
+	// Timeouts too short to check twice in are checked as often as allowed,
+	// rather than making the ticker panic.
+	w := NewWriter("group", "1234", new(mockClient), WriterOptions{
+		PartialLineTimeout: time.Nanosecond,
+		Multiline:          &MultilineOptions{IdleTimeout: time.Nanosecond},
+	})
+	assert.Equal(t, minIdleCheck, w.idleCheckEvery())
+	assert.NoError(t, w.Close())
+
+	w = &Writer{opts: WriterOptions{PartialLineTimeout: time.Minute}}
+	assert.Equal(t, 30*time.Second, w.idleCheckEvery())
+}
+
+func TestWriter_StripNewlines(t *testing.T) {
+	c := new(mockClient)
+	w := &Writer{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: c,
+		core:   newStreamCore(),
+		opts:   WriterOptions{StripNewlines: true},
+	}
+
+	c.On("PutLogEvents", &cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("Hello"), Timestamp: aws.Int64(1000)},
+			{Message: aws.String("World"), Timestamp: aws.Int64(1000)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	}).Return(&cloudwatchlogs.PutLogEventsOutput{}, nil)
+
+	_, err := io.WriteString(w, "Hello\r\n\nWorld\n")
+	assert.NoError(t, err)
+
+	err = w.Flush()
+	assert.NoError(t, err)
+
+	c.AssertExpectations(t)
+}
+
 func TestWriter_Close(t *testing.T) {
 	c := new(mockClient)
 	w := &Writer{
 		group:  aws.String("group"),
 		stream: aws.String("1234"),
 		client: c,
+		core:   newStreamCore(),
 	}
 
 	c.On("PutLogEvents", &cloudwatchlogs.PutLogEventsInput{
@@ -132,3 +336,437 @@ func TestWriter_Close(t *testing.T) {
 
 	c.AssertExpectations(t)
 }
+
+func TestWriter_CloseStopsFlushing(t *testing.T) {
+	c := new(mockClient)
+	w := NewWriter("group", "1234", c, WriterOptions{FlushEvery: time.Hour})
+
+	c.On("PutLogEvents", &cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("Hello\n"), Timestamp: aws.Int64(1000)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	}).Return(&cloudwatchlogs.PutLogEventsOutput{}, nil)
+
+	io.WriteString(w, "Hello\n")
+
+	err := w.Close()
+	assert.NoError(t, err)
+
+	select {
+	case <-w.stopped:
+	default:
+		t.Fatal("expected the flushing goroutine to have stopped")
+	}
+
+	// Closing again is a no-op.
+	assert.NoError(t, w.Close())
+
+	c.AssertExpectations(t)
+}
+
+func TestWriter_CloseContext(t *testing.T) {
+	c := new(mockClient)
+	released := 0
+	w := &Writer{
+		group:   aws.String("group"),
+		stream:  aws.String("1234"),
+		client:  c,
+		core:    newStreamCore(),
+		release: func() { released++ },
+	}
+
+	input := &cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("Hello\n"), Timestamp: aws.Int64(1000)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	}
+	errCanceled := awserr.New(request.CanceledErrorCode, "request context canceled", context.Canceled)
+	c.On("PutLogEvents", input).Once().Return(&cloudwatchlogs.PutLogEventsOutput{}, errCanceled)
+	c.On("PutLogEvents", input).Once().Return(&cloudwatchlogs.PutLogEventsOutput{}, nil)
+
+	io.WriteString(w, "Hello\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The Writer is closed to writes, but the events it couldn't send stay
+	// buffered.
+	assert.Equal(t, errCanceled, w.CloseContext(ctx))
+	_, err := io.WriteString(w, "World\n")
+	assert.Equal(t, io.ErrClosedPipe, err)
+	assert.Equal(t, 0, released)
+
+	// Closing again sends them.
+	assert.NoError(t, w.Close())
+	assert.Equal(t, 1, released)
+
+	assert.NoError(t, w.Close())
+	assert.Equal(t, 1, released)
+
+	c.AssertExpectations(t)
+}
+
+func TestWriter_FlushContext(t *testing.T) {
+	c := new(mockClient)
+	w := &Writer{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: c,
+		core:   newStreamCore(),
+	}
+
+	input := &cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("Hello\n"), Timestamp: aws.Int64(1000)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	}
+	errCanceled := awserr.New(request.CanceledErrorCode, "request context canceled", context.Canceled)
+	c.On("PutLogEvents", input).Once().Return(&cloudwatchlogs.PutLogEventsOutput{}, errCanceled)
+	c.On("PutLogEvents", input).Once().Return(&cloudwatchlogs.PutLogEventsOutput{}, nil)
+
+	io.WriteString(w, "Hello\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := w.FlushContext(ctx)
+	assert.Equal(t, errCanceled, err)
+
+	// The events are still buffered, and are sent by the next flush.
+	err = w.Flush()
+	assert.NoError(t, err)
+
+	c.AssertExpectations(t)
+}
+
+func TestWriter_FlushWhenFull(t *testing.T) {
+	c := new(mockClient)
+	w := NewWriter("group", "1234", c, WriterOptions{FlushEvery: time.Hour, FlushEvents: 2})
+	defer w.Close()
+
+	flushed := make(chan struct{})
+	c.On("PutLogEvents", &cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("Hello\n"), Timestamp: aws.Int64(1000)},
+			{Message: aws.String("World\n"), Timestamp: aws.Int64(1000)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	}).Once().Run(func(mock.Arguments) { close(flushed) }).Return(&cloudwatchlogs.PutLogEventsOutput{}, nil)
+
+	io.WriteString(w, "Hello\nWorld\n")
+
+	select {
+	case <-flushed:
+	case <-time.After(time.Second):
+		t.Fatal("expected the events to be flushed before the next tick")
+	}
+
+	c.AssertExpectations(t)
+}
+
+func TestWriter_PutThrottle(t *testing.T) {
+	defer func(s func(context.Context, time.Duration) error) { sleep = s }(sleep)
+
+	var slept time.Duration
+	sleep = func(_ context.Context, d time.Duration) error {
+		slept += d
+		return nil
+	}
+
+	c := new(mockClient)
+	w := &Writer{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: c,
+		core:   newStreamCore(),
+	}
+	c.On("PutLogEvents", mock.Anything).Return(&cloudwatchlogs.PutLogEventsOutput{}, nil)
+
+	io.WriteString(w, "Hello\n")
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, time.Duration(0), slept)
+
+	// now is stubbed out, so the second request appears to be made straight
+	// after the first, and has to wait.
+	io.WriteString(w, "World\n")
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, putThrottle, slept)
+}
+
+func TestWriter_Batches(t *testing.T) {
+	c := new(mockClient)
+	w := &Writer{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: c,
+		core:   newStreamCore(),
+	}
+
+	for i := 0; i < maximumLogEventsPerPut+1; i++ {
+		io.WriteString(w, "Hello\n")
+	}
+
+	c.On("PutLogEvents", mock.MatchedBy(func(input *cloudwatchlogs.PutLogEventsInput) bool {
+		return len(input.LogEvents) == maximumLogEventsPerPut && input.SequenceToken == nil
+	})).Once().Return(&cloudwatchlogs.PutLogEventsOutput{
+		NextSequenceToken: aws.String("next"),
+	}, nil)
+
+	c.On("PutLogEvents", mock.MatchedBy(func(input *cloudwatchlogs.PutLogEventsInput) bool {
+		return len(input.LogEvents) == 1 && aws.StringValue(input.SequenceToken) == "next"
+	})).Once().Return(&cloudwatchlogs.PutLogEventsOutput{}, nil)
+
+	err := w.Flush()
+	assert.NoError(t, err)
+
+	c.AssertExpectations(t)
+}
+
+func TestWriter_Retry(t *testing.T) {
+	c := new(mockClient)
+	w := &Writer{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: c,
+		core:   newStreamCore(),
+	}
+
+	input := &cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("Hello\n"), Timestamp: aws.Int64(1000)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	}
+	c.On("PutLogEvents", input).Once().Return(&cloudwatchlogs.PutLogEventsOutput{},
+		awserr.New(throttlingCode, "Rate exceeded", nil))
+	c.On("PutLogEvents", input).Once().Return(&cloudwatchlogs.PutLogEventsOutput{},
+		awserr.New(invalidSequenceTokenCode, "The next expected sequenceToken is: next", nil))
+
+	retried := *input
+	retried.SequenceToken = aws.String("next")
+	c.On("PutLogEvents", &retried).Once().Return(&cloudwatchlogs.PutLogEventsOutput{
+		NextSequenceToken: aws.String("after"),
+	}, nil)
+
+	io.WriteString(w, "Hello\n")
+
+	err := w.Flush()
+	assert.NoError(t, err)
+	assert.Equal(t, "after", *w.core.sequenceToken)
+
+	c.AssertExpectations(t)
+}
+
+func TestWriter_RetryToken(t *testing.T) {
+	c := new(mockClient)
+	w := &Writer{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: c,
+		core:   newStreamCore(),
+		opts:   WriterOptions{RetryPolicy: &RetryPolicy{MaxAttempts: 1}},
+	}
+
+	input := &cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{Message: aws.String("Hello\n"), Timestamp: aws.Int64(1000)},
+		},
+		LogGroupName:  aws.String("group"),
+		LogStreamName: aws.String("1234"),
+	}
+	c.On("PutLogEvents", input).Once().Return(&cloudwatchlogs.PutLogEventsOutput{},
+		awserr.New(invalidSequenceTokenCode, "The next expected sequenceToken is: next", nil))
+
+	retried := *input
+	retried.SequenceToken = aws.String("next")
+	c.On("PutLogEvents", &retried).Once().Return(&cloudwatchlogs.PutLogEventsOutput{}, nil)
+
+	// Correcting the sequence token doesn't use up an attempt.
+	io.WriteString(w, "Hello\n")
+	assert.NoError(t, w.Flush())
+
+	// But a token that stays invalid isn't retried forever.
+	c.On("PutLogEvents", mock.Anything).Times(maxTokenRefreshes+1).Return(&cloudwatchlogs.PutLogEventsOutput{},
+		awserr.New(invalidSequenceTokenCode, "The next expected sequenceToken is: next", nil))
+	io.WriteString(w, "World\n")
+	assert.Error(t, w.Flush())
+
+	c.AssertExpectations(t)
+}
+
+func TestWriter_Dropped(t *testing.T) {
+	var (
+		dropped []*cloudwatchlogs.InputLogEvent
+		reason  error
+	)
+
+	c := new(mockClient)
+	w := &Writer{
+		group:  aws.String("group"),
+		stream: aws.String("1234"),
+		client: c,
+		core:   newStreamCore(),
+		opts: WriterOptions{
+			RetryPolicy: &RetryPolicy{MaxAttempts: 2},
+			OnDropped: func(events []*cloudwatchlogs.InputLogEvent, err error) {
+				dropped, reason = events, err
+			},
+		},
+	}
+
+	errThrottled := awserr.New(throttlingCode, "Rate exceeded", nil)
+	c.On("PutLogEvents", mock.Anything).Twice().Return(&cloudwatchlogs.PutLogEventsOutput{}, errThrottled)
+
+	io.WriteString(w, "Hello\n")
+
+	w.Flush()
+	assert.Equal(t, 1, len(dropped))
+	assert.Equal(t, errThrottled, reason)
+
+	c.AssertExpectations(t)
+}
+
+func TestWriter_SharedStream(t *testing.T) {
+	f := cloudwatchtest.New()
+	f.Now = now
+
+	g, err := AttachGroup("group", f)
+	assert.NoError(t, err)
+
+	// The Writers share the stream's sequence token, so the second one
+	// carries on from the token the first one left the stream with.
+	first, err := g.AttachStream("1234")
+	assert.NoError(t, err)
+	second, err := g.AttachStream("1234")
+	assert.NoError(t, err)
+	assert.True(t, first.core == second.core)
+
+	io.WriteString(first, "Hello\n")
+	assert.NoError(t, first.Close())
+
+	io.WriteString(second, "World\n")
+	assert.NoError(t, second.Close())
+
+	assert.Equal(t, []string{"Hello\n", "World\n"}, f.Messages("group", "1234"))
+	assert.Equal(t, 2, f.Calls("PutLogEvents"))
+
+	// The shared state is dropped once every Writer is closed.
+	assert.Empty(t, g.streams)
+
+	// Writers made without the Group don't share it, and have to pick up
+	// the token from the error CloudWatch Logs returns.
+	w := NewWriter("group", "1234", f, WriterOptions{})
+	io.WriteString(w, "Again\n")
+	assert.NoError(t, w.Close())
+	assert.Equal(t, 4, f.Calls("PutLogEvents"))
+}
+
+func TestWriter_SharedStreamContext(t *testing.T) {
+	f := cloudwatchtest.New()
+	f.Now = now
+
+	g, err := AttachGroup("group", f)
+	assert.NoError(t, err)
+
+	first, err := g.AttachStream("1234")
+	assert.NoError(t, err)
+	second, err := g.AttachStream("1234")
+	assert.NoError(t, err)
+
+	// While another Writer holds the stream, a flush gives up when its
+	// context is done rather than waiting for it.
+	assert.NoError(t, first.core.lock(context.Background()))
+
+	io.WriteString(second, "Hello\n")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, second.FlushContext(ctx))
+	assert.Equal(t, 0, f.Calls("PutLogEvents"))
+
+	// The events are sent once the stream is free again.
+	first.core.unlock()
+	assert.NoError(t, second.Close())
+	assert.NoError(t, first.Close())
+	assert.Equal(t, []string{"Hello\n"}, f.Messages("group", "1234"))
+}
+
+func TestWriter_SharedStreamConcurrent(t *testing.T) {
+	f := cloudwatchtest.New()
+	f.Now = now
+
+	g, err := AttachGroup("group", f)
+	assert.NoError(t, err)
+
+	var writers []*Writer
+	for i := 0; i < 4; i++ {
+		w, err := g.AttachStream("1234")
+		assert.NoError(t, err)
+		writers = append(writers, w)
+	}
+	other, err := g.AttachStream("5678")
+	assert.NoError(t, err)
+	assert.False(t, other.core == writers[0].core)
+	assert.NoError(t, other.Close())
+
+	var wg sync.WaitGroup
+	for _, w := range writers {
+		wg.Add(1)
+		go func(w *Writer) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				io.WriteString(w, "Hello\n")
+				assert.NoError(t, w.Flush())
+			}
+			assert.NoError(t, w.Close())
+		}(w)
+	}
+	wg.Wait()
+
+	// No requests were made with a stale sequence token.
+	assert.Equal(t, 40, len(f.Messages("group", "1234")))
+	assert.Equal(t, 40, f.Calls("PutLogEvents"))
+	assert.Empty(t, g.streams)
+}
+
+func TestBatches(t *testing.T) {
+	event := func(message string, timestamp int64) *cloudwatchlogs.InputLogEvent {
+		return &cloudwatchlogs.InputLogEvent{
+			Message:   aws.String(message),
+			Timestamp: aws.Int64(timestamp),
+		}
+	}
+
+	t.Run("bytes", func(t *testing.T) {
+		large := strings.Repeat("a", maximumBytesPerPut/2)
+		b := batches([]*cloudwatchlogs.InputLogEvent{
+			event(large, 1000),
+			event(large, 1000),
+			event("small", 1000),
+		})
+		assert.Equal(t, 2, len(b))
+		assert.Equal(t, 1, len(b[0]))
+		assert.Equal(t, 2, len(b[1]))
+	})
+
+	t.Run("span", func(t *testing.T) {
+		b := batches([]*cloudwatchlogs.InputLogEvent{
+			event("a", 1000),
+			event("b", 1000+maximumBatchSpan),
+			event("c", 1001+maximumBatchSpan),
+		})
+		assert.Equal(t, 2, len(b))
+		assert.Equal(t, "c", *b[1][0].Message)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		assert.Nil(t, batches(nil))
+	})
+}